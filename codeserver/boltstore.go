@@ -77,6 +77,67 @@ func (bs *boltStore) DelByName(name string) {
 	})
 }
 
+type boltBucket struct {
+	db   *bolt.DB
+	name []byte
+}
+
+// Bucket returns storage for given bucket, bucket is created if needed
+func (bs *boltStore) Bucket(name string) (BucketStore, error) {
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return fmt.Errorf("create bucket: %s", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltBucket{db: bs.db, name: []byte(name)}, nil
+}
+
+// Put ...
+func (bb *boltBucket) Put(key string, value []byte) error {
+	return bb.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bb.name).Put([]byte(key), value)
+	})
+}
+
+// Get ...
+func (bb *boltBucket) Get(key string) (value []byte, found bool) {
+	bb.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bb.name).Get([]byte(key))
+		if v != nil {
+			// value is valid only during transaction
+			value = append([]byte{}, v...)
+			found = true
+		}
+		return nil
+	})
+	return
+}
+
+// Keys ...
+func (bb *boltBucket) Keys() []string {
+	keys := []string{}
+	bb.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bb.name).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	return keys
+}
+
+// Del ...
+func (bb *boltBucket) Del(key string) {
+	bb.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bb.name).Delete([]byte(key))
+	})
+}
+
 // Close ...
 func (bs *boltStore) Close() {
 	bs.db.Close()
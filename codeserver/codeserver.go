@@ -16,9 +16,19 @@ type CodeStore interface {
 	GetByName(name string) ([]byte, bool)
 	GetAll() []string
 	DelByName(name string)
+	Bucket(name string) (BucketStore, error)
 	Close()
 }
 
+// BucketStore represents storage API for named entries
+// in other bucket than packages
+type BucketStore interface {
+	Put(key string, value []byte) error
+	Get(key string) ([]byte, bool)
+	Keys() []string
+	Del(key string)
+}
+
 // CodeServer represents codeserver
 type CodeServer struct {
 	store CodeStore
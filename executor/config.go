@@ -0,0 +1,312 @@
+package executor
+
+import (
+	"apprunner/codeserver"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/anssihalmeaho/funl/funl"
+)
+
+const (
+	secretMask   = "******"
+	secretKeyLen = 32
+)
+
+// configStore contains named config maps and secrets,
+// secrets are encrypted before storing
+type configStore struct {
+	configs codeserver.BucketStore
+	secrets codeserver.BucketStore
+	gcm     cipher.AEAD
+}
+
+// SetConfigStore sets storages for config maps and secrets, secrets are
+// encrypted with given secret key (32 bytes as hex string, AES-256)
+func (runner *Executor) SetConfigStore(configs, secrets codeserver.BucketStore, secretKey string) error {
+	cs := &configStore{configs: configs, secrets: secrets}
+	if secretKey != "" {
+		key, err := hex.DecodeString(secretKey)
+		if err != nil || len(key) != secretKeyLen {
+			return fmt.Errorf("secret key should be %d bytes given as %d hex digits", secretKeyLen, 2*secretKeyLen)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return err
+		}
+		if cs.gcm, err = cipher.NewGCM(block); err != nil {
+			return err
+		}
+	}
+	runner.configs = cs
+	return nil
+}
+
+func (cs *configStore) encrypt(plain []byte) ([]byte, error) {
+	nonce := make([]byte, cs.gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return cs.gcm.Seal(nonce, nonce, plain, nil), nil
+}
+
+func (cs *configStore) decrypt(data []byte) ([]byte, error) {
+	nonceSize := cs.gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("invalid secret data")
+	}
+	return cs.gcm.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+}
+
+// getSecrets reads and decrypts secret entries
+func (cs *configStore) getSecrets(name string) (map[string]string, bool, error) {
+	data, found := cs.secrets.Get(name)
+	if !found {
+		return nil, false, nil
+	}
+	if cs.gcm == nil {
+		return nil, true, fmt.Errorf("secret key not configured")
+	}
+	plain, err := cs.decrypt(data)
+	if err != nil {
+		return nil, true, fmt.Errorf("secret decryption failed")
+	}
+	entries := map[string]string{}
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return nil, true, err
+	}
+	return entries, true, nil
+}
+
+// maskSecrets replaces secret values in text
+func maskSecrets(text string, secrets map[string]string) string {
+	for _, value := range secrets {
+		if value != "" {
+			text = strings.ReplaceAll(text, value, secretMask)
+		}
+	}
+	return text
+}
+
+// getSecretsProc returns procedure for reading secrets:
+// secrets(<name:string>) -> string, secrets() -> list of names
+func (runner *Executor) getSecretsProc(secrets map[string]string) func(*funl.Frame, []funl.Value) funl.Value {
+	return func(frame *funl.Frame, arguments []funl.Value) funl.Value {
+		if len(arguments) == 0 {
+			names := []string{}
+			for name := range secrets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			values := []funl.Value{}
+			for _, name := range names {
+				values = append(values, funl.Value{Kind: funl.StringValue, Data: name})
+			}
+			return funl.MakeListOfValues(frame, values)
+		}
+		if arguments[0].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "secrets: requires string value")
+		}
+		value, found := secrets[arguments[0].Data.(string)]
+		if !found {
+			funl.RunTimeError2(frame, "secrets: not found: %s", arguments[0].Data.(string))
+		}
+		return funl.Value{Kind: funl.StringValue, Data: value}
+	}
+}
+
+// getAppConfig reads config map and secrets referred by app,
+// in case of error also status code is returned
+func (runner *Executor) getAppConfig(configName, secretsName string) (config funl.Value, secrets map[string]string, status int, err error) {
+	if configName == "" && secretsName == "" {
+		return
+	}
+	if runner.configs == nil {
+		return config, nil, http.StatusServiceUnavailable, fmt.Errorf("config store not available")
+	}
+	if configName != "" {
+		data, found := runner.configs.configs.Get(configName)
+		if !found {
+			return config, nil, http.StatusNotFound, fmt.Errorf("config not found: %s", configName)
+		}
+		if config, err = runner.argsEval.decodeJSON(data); err != nil {
+			return config, nil, http.StatusInternalServerError, err
+		}
+	}
+	if secretsName != "" {
+		var found bool
+		secrets, found, err = runner.configs.getSecrets(secretsName)
+		if !found {
+			return config, nil, http.StatusNotFound, fmt.Errorf("secrets not found: %s", secretsName)
+		}
+		if err != nil {
+			return config, nil, http.StatusServiceUnavailable, err
+		}
+	}
+	return
+}
+
+func (runner *Executor) handleConfigPost(w http.ResponseWriter, r *http.Request, secret bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	name := pathParts[len(pathParts)-1]
+	if name == "" {
+		http.Error(w, "assuming name", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !secret {
+		var entries map[string]interface{}
+		if err := json.Unmarshal(body, &entries); err != nil {
+			http.Error(w, "config should be JSON object", http.StatusBadRequest)
+			return
+		}
+		if err := runner.configs.configs.Put(name, body); err != nil {
+			log.Printf("Error in storing config: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	if runner.configs.gcm == nil {
+		http.Error(w, "secret key not configured", http.StatusServiceUnavailable)
+		return
+	}
+	var entries map[string]string
+	if err := json.Unmarshal(body, &entries); err != nil {
+		http.Error(w, "secrets should be JSON object with string values", http.StatusBadRequest)
+		return
+	}
+	data, err := runner.configs.encrypt(body)
+	if err == nil {
+		err = runner.configs.secrets.Put(name, data)
+	}
+	if err != nil {
+		log.Printf("Error in storing secrets: %s", name)
+		http.Error(w, "error in storing secrets", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (runner *Executor) handleConfigGetAll(w http.ResponseWriter, r *http.Request, secret bool) {
+	store := runner.configs.configs
+	if secret {
+		store = runner.configs.secrets
+	}
+	resp, err := json.Marshal(store.Keys())
+	if err != nil {
+		log.Printf("Error in reading names: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// handleConfigGet returns config map, for secrets only names of entries are returned
+func (runner *Executor) handleConfigGet(w http.ResponseWriter, r *http.Request, secret bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	name := pathParts[len(pathParts)-1]
+
+	if !secret {
+		data, found := runner.configs.configs.Get(name)
+		if !found {
+			http.Error(w, "config not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+		return
+	}
+
+	secrets, found, err := runner.configs.getSecrets(name)
+	if !found {
+		http.Error(w, "secrets not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	names := []string{}
+	for entry := range secrets {
+		names = append(names, entry)
+	}
+	sort.Strings(names)
+	resp, err := json.Marshal(&names)
+	if err != nil {
+		log.Printf("Error in reading secrets: %s", name)
+		http.Error(w, "error in reading secrets", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (runner *Executor) handleConfigDelete(w http.ResponseWriter, r *http.Request, secret bool) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	name := pathParts[len(pathParts)-1]
+	if secret {
+		runner.configs.secrets.Del(name)
+		return
+	}
+	runner.configs.configs.Del(name)
+}
+
+// getConfigHandlers returns handlers for configs (secret=false) or secrets (secret=true)
+func (runner *Executor) getConfigHandlers(secret bool) (hCol, hRes func(w http.ResponseWriter, r *http.Request)) {
+	hCol = func(w http.ResponseWriter, r *http.Request) {
+		if runner.configs == nil {
+			http.Error(w, "config store not available", http.StatusServiceUnavailable)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			runner.handleConfigGetAll(w, r, secret)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+	hRes = func(w http.ResponseWriter, r *http.Request) {
+		if runner.configs == nil {
+			http.Error(w, "config store not available", http.StatusServiceUnavailable)
+			return
+		}
+		switch r.Method {
+		case "POST":
+			runner.handleConfigPost(w, r, secret)
+		case "GET":
+			runner.handleConfigGet(w, r, secret)
+		case "DELETE":
+			runner.handleConfigDelete(w, r, secret)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+	return
+}
+
+// GetConfigHandler gets handler for config maps
+func (runner *Executor) GetConfigHandler() (hCol, hRes func(w http.ResponseWriter, r *http.Request)) {
+	return runner.getConfigHandlers(false)
+}
+
+// GetSecretHandler gets handler for secrets
+func (runner *Executor) GetSecretHandler() (hCol, hRes func(w http.ResponseWriter, r *http.Request)) {
+	return runner.getConfigHandlers(true)
+}
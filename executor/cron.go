@@ -0,0 +1,152 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maximum time searched forward for next matching time
+const maxCronSearchMinutes = 5 * 366 * 24 * 60
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronExpr is parsed cron expression (minute hour day-of-month month day-of-week)
+type cronExpr struct {
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+
+	// day restrictions are OR'ed if both are given
+	anyDay     bool
+	anyWeekday bool
+}
+
+// parseCronField parses one field, like: *, */5, 1-10/2, 1,15,30
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		rangePart := part
+		step := 1
+		if parts := strings.Split(part, "/"); len(parts) == 2 {
+			var err error
+			step, err = strconv.Atoi(parts[1])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step: %s", part)
+			}
+			rangePart = parts[0]
+		} else if len(parts) > 2 {
+			return nil, fmt.Errorf("invalid field: %s", part)
+		}
+
+		start, end := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.Split(rangePart, "-")
+			if len(bounds) != 2 {
+				return nil, fmt.Errorf("invalid range: %s", part)
+			}
+			var err1, err2 error
+			start, err1 = strconv.Atoi(bounds[0])
+			end, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("invalid range: %s", part)
+			}
+		default:
+			var err error
+			start, err = strconv.Atoi(rangePart)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value: %s", part)
+			}
+			end = start
+		}
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("value out of range (%d-%d): %s", min, max, part)
+		}
+		for v := start; v <= end; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func parseCron(expr string) (*cronExpr, error) {
+	if descriptor, found := cronDescriptors[strings.TrimSpace(expr)]; found {
+		expr = descriptor
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression should have 5 fields: %s", expr)
+	}
+	var err error
+	cron := &cronExpr{
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}
+	if cron.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if cron.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if cron.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if cron.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if cron.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// sunday can be given as 0 or 7
+	if cron.weekdays[7] {
+		cron.weekdays[0] = true
+	}
+	return cron, nil
+}
+
+func (cron *cronExpr) matchDay(t time.Time) bool {
+	dayMatch := cron.days[t.Day()]
+	weekdayMatch := cron.weekdays[int(t.Weekday())]
+	switch {
+	case cron.anyDay && cron.anyWeekday:
+		return true
+	case cron.anyDay:
+		return weekdayMatch
+	case cron.anyWeekday:
+		return dayMatch
+	}
+	return dayMatch || weekdayMatch
+}
+
+// next returns next matching time after given time
+func (cron *cronExpr) next(after time.Time) (time.Time, bool) {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxCronSearchMinutes * time.Minute)
+	for t.Before(limit) {
+		switch {
+		case !cron.months[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !cron.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !cron.hours[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !cron.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,128 @@
+package executor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field string
+		min   int
+		max   int
+		want  []int
+		ok    bool
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}, true},
+		{"*/2", 0, 5, []int{0, 2, 4}, true},
+		{"1-4/3", 0, 5, []int{1, 4}, true},
+		{"1,3,5", 0, 5, []int{1, 3, 5}, true},
+		{"2-2", 0, 5, []int{2}, true},
+		{"0", 0, 59, []int{0}, true},
+		{"59", 0, 59, []int{59}, true},
+		{"1-3,5", 0, 5, []int{1, 2, 3, 5}, true},
+		{"60", 0, 59, nil, false},
+		{"0", 1, 31, nil, false},
+		{"5-1", 0, 59, nil, false},
+		{"*/0", 0, 59, nil, false},
+		{"*/-1", 0, 59, nil, false},
+		{"1/2/3", 0, 59, nil, false},
+		{"-1", 0, 59, nil, false},
+		{"1-", 0, 59, nil, false},
+		{"1-2-3", 0, 59, nil, false},
+		{"a", 0, 59, nil, false},
+		{"", 0, 59, nil, false},
+		{"1,,2", 0, 59, nil, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.field, func(t *testing.T) {
+			values, err := parseCronField(tc.field, tc.min, tc.max)
+			if !tc.ok {
+				if err == nil {
+					t.Fatalf("expected error, got %v", values)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(values) != len(tc.want) {
+				t.Fatalf("got %v, want %v", values, tc.want)
+			}
+			for _, v := range tc.want {
+				if !values[v] {
+					t.Errorf("value %d missing from %v", v, values)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr string
+		ok   bool
+	}{
+		{"* * * * *", true},
+		{"@daily", true},
+		{" @hourly ", true},
+		{"0 0 * * 7", true},
+		{"0 0 1 1 *", true},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"@never", false},
+		{"0 24 * * *", false},
+		{"0 0 32 * *", false},
+		{"0 0 * 13 *", false},
+		{"0 0 * * 8", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			_, err := parseCron(tc.expr)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	after := time.Date(2025, time.January, 31, 10, 30, 45, 0, time.UTC)
+	tests := []struct {
+		expr  string
+		want  time.Time
+		found bool
+	}{
+		{"* * * * *", time.Date(2025, time.January, 31, 10, 31, 0, 0, time.UTC), true},
+		{"30 10 * * *", time.Date(2025, time.February, 1, 10, 30, 0, 0, time.UTC), true},
+		{"0 0 1 * *", time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC), true},
+		{"@yearly", time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), true},
+		{"0 0 * * 0", time.Date(2025, time.February, 2, 0, 0, 0, 0, time.UTC), true},
+		{"0 0 * * 7", time.Date(2025, time.February, 2, 0, 0, 0, 0, time.UTC), true},
+		// day-of-month and day-of-week are OR'ed if both are given
+		{"0 0 15 * 1", time.Date(2025, time.February, 3, 0, 0, 0, 0, time.UTC), true},
+		{"0 0 31 * *", time.Date(2025, time.March, 31, 0, 0, 0, 0, time.UTC), true},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC), true},
+		{"0 0 30 2 *", time.Time{}, false},
+		{"0 0 31 2 *", time.Time{}, false},
+		{"0 0 31 4,6,9,11 *", time.Time{}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.expr, func(t *testing.T) {
+			cron, err := parseCron(tc.expr)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			next, found := cron.next(after)
+			if found != tc.found {
+				t.Fatalf("found: got %v, want %v", found, tc.found)
+			}
+			if !next.Equal(tc.want) {
+				t.Errorf("got %v, want %v", next, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package executor
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"apprunner/extensions"
+)
+
+// SetDataDir sets base directory under which each app gets own data
+// directory (by app name), if restrictValuez is true valuez databases
+// can be opened only under data directory of app
+func (runner *Executor) SetDataDir(dir string, restrictValuez bool) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(absDir, 0700); err != nil {
+		return err
+	}
+	runner.dataDir = absDir
+	extensions.SetValuezRestricted(restrictValuez)
+	return nil
+}
+
+// appDataDir returns data directory path of app
+func (runner *Executor) appDataDir(name string) (string, error) {
+	if runner.dataDir == "" {
+		return "", fmt.Errorf("data directory not configured")
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("app name not usable as directory: %s", name)
+	}
+	return filepath.Join(runner.dataDir, name), nil
+}
+
+// checkDataDirName returns error if data directory is configured
+// and app name can't be used as its data directory
+func (runner *Executor) checkDataDirName(name string) error {
+	if runner.dataDir == "" {
+		return nil
+	}
+	_, err := runner.appDataDir(name)
+	return err
+}
+
+// makeAppDataDir creates data directory of app (if not existing)
+func (runner *Executor) makeAppDataDir(name string) (string, error) {
+	dir, err := runner.appDataDir(name)
+	if err != nil {
+		return "", err
+	}
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// isAppRunning tells whether app group or some instance with given name exists
+func (runner *Executor) isAppRunning(name string) bool {
+	if runner.appstore.hasGroupWithName(name) {
+		return true
+	}
+	return len(runner.appstore.getByName(name)) > 0
+}
+
+// dataInfo returns information of app data directory and its files
+func (runner *Executor) dataInfo(name, dir string, withFiles bool) (map[string]interface{}, error) {
+	var size int64
+	files := []map[string]interface{}{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		size += info.Size()
+		rel, _ := filepath.Rel(dir, path)
+		files = append(files, map[string]interface{}{
+			"name":     filepath.ToSlash(rel),
+			"size":     info.Size(),
+			"modified": info.ModTime().Format(time.RFC3339),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := map[string]interface{}{
+		"name":    name,
+		"path":    dir,
+		"size":    size,
+		"count":   len(files),
+		"running": runner.isAppRunning(name),
+	}
+	if withFiles {
+		info["files"] = files
+	}
+	return info, nil
+}
+
+// wipeAppData removes data directory of app, app should not be running
+func (runner *Executor) wipeAppData(name string) (int, error) {
+	dir, err := runner.appDataDir(name)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return http.StatusNotFound, fmt.Errorf("app data not found")
+	}
+	if runner.isAppRunning(name) {
+		return http.StatusConflict, fmt.Errorf("app is running: %s", name)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// writeBackup writes files of directory as gzipped tar archive
+func writeBackup(w io.Writer, dir string) error {
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.CopyN(tw, f, info.Size())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+func (runner *Executor) handleDataGetAll(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(runner.dataDir)
+	if err != nil {
+		log.Printf("Error in reading app data: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	dataResp := []map[string]interface{}{}
+	for _, name := range names {
+		info, err := runner.dataInfo(name, filepath.Join(runner.dataDir, name), false)
+		if err != nil {
+			log.Printf("Error in reading app data (%s): %v", name, err)
+			continue
+		}
+		dataResp = append(dataResp, info)
+	}
+	resp, err := json.Marshal(&dataResp)
+	if err != nil {
+		log.Printf("Error in reading app data: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (runner *Executor) handleDataGet(w http.ResponseWriter, r *http.Request, name string) {
+	dir, err := runner.appDataDir(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Stat(dir); err != nil {
+		http.Error(w, "app data not found", http.StatusNotFound)
+		return
+	}
+	info, err := runner.dataInfo(name, dir, true)
+	if err != nil {
+		log.Printf("Error in reading app data (%s): %v", name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, err := json.Marshal(info)
+	if err != nil {
+		log.Printf("Error in reading app data: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (runner *Executor) handleDataBackup(w http.ResponseWriter, r *http.Request, name string) {
+	dir, err := runner.appDataDir(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Stat(dir); err != nil {
+		http.Error(w, "app data not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.tar.gz\"", name))
+	if err := writeBackup(w, dir); err != nil {
+		// headers are already sent so error is only logged
+		log.Printf("Error in backup of app data (%s): %v", name, err)
+	}
+}
+
+func (runner *Executor) handleDataDelete(w http.ResponseWriter, r *http.Request, name string) {
+	if status, err := runner.wipeAppData(name); err != nil {
+		http.Error(w, err.Error(), status)
+	}
+}
+
+// GetDataHandler gets handler for listing, backing up and wiping app data directories
+func (runner *Executor) GetDataHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if runner.dataDir == "" {
+			http.Error(w, "data directory not configured", http.StatusServiceUnavailable)
+			return
+		}
+		pathParts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/app-data"), "/"), "/")
+		name := pathParts[0]
+		backup := len(pathParts) == 2 && pathParts[1] == "backup"
+
+		switch {
+		case r.Method == "GET" && name == "":
+			runner.handleDataGetAll(w, r)
+		case name == "":
+			http.Error(w, "assuming app name", http.StatusBadRequest)
+		case len(pathParts) > 2 || (len(pathParts) == 2 && !backup):
+			http.Error(w, "not found", http.StatusNotFound)
+		case r.Method == "GET" && backup:
+			runner.handleDataBackup(w, r, name)
+		case r.Method == "GET":
+			runner.handleDataGet(w, r, name)
+		case r.Method == "DELETE" && !backup:
+			runner.handleDataDelete(w, r, name)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAppDataDir(t *testing.T) {
+	base := t.TempDir()
+	runner := &Executor{dataDir: base}
+
+	tests := []struct {
+		name    string
+		appName string
+		ok      bool
+	}{
+		{"plain name", "myapp", true},
+		{"name with dots", "my.app", true},
+		{"empty", "", false},
+		{"dot", ".", false},
+		{"dot dot", "..", false},
+		{"slash", "a/b", false},
+		{"dot dot escape", "../other", false},
+		{"absolute", "/etc", false},
+		{"backslash", `a\b`, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := runner.appDataDir(tc.appName)
+			if !tc.ok {
+				if err == nil {
+					t.Fatalf("expected error, got %s", dir)
+				}
+				if err := runner.checkDataDirName(tc.appName); err == nil {
+					t.Fatalf("expected name to be refused")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if dir != filepath.Join(base, tc.appName) || filepath.Dir(dir) != base {
+				t.Errorf("unexpected directory: %s", dir)
+			}
+		})
+	}
+}
+
+func TestAppDataDirNotConfigured(t *testing.T) {
+	runner := &Executor{}
+	if _, err := runner.appDataDir("myapp"); err == nil {
+		t.Error("expected error when data directory is not configured")
+	}
+	if err := runner.checkDataDirName(""); err != nil {
+		t.Errorf("name should not be checked without data directory: %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envSpec tells which host environment variables and
+// literal values are given to app
+type envSpec struct {
+	Vars   []string          `json:"vars"`
+	Values map[string]string `json:"values"`
+}
+
+// isEnvAllowed tells whether environment variable is in allow-list,
+// allow-list item ending with * matches prefix
+func (runner *Executor) isEnvAllowed(name string) bool {
+	for _, allowed := range runner.envAllow {
+		if strings.HasSuffix(allowed, "*") {
+			if strings.HasPrefix(name, strings.TrimSuffix(allowed, "*")) {
+				return true
+			}
+		} else if name == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveEnv returns environment entries for app, variables
+// which are not set in host environment are left out
+func (runner *Executor) resolveEnv(spec *envSpec) (map[string]string, error) {
+	env := map[string]string{}
+	if spec == nil {
+		return env, nil
+	}
+	for _, name := range spec.Vars {
+		if !runner.isEnvAllowed(name) {
+			return nil, fmt.Errorf("environment variable not allowed: %s", name)
+		}
+		if value, found := os.LookupEnv(name); found {
+			env[name] = value
+		}
+	}
+	for name, value := range spec.Values {
+		env[name] = value
+	}
+	return env, nil
+}
+
+// SetEnvAllowList sets comma separated list of host environment
+// variables which apps may read (like "HOME,APP_*")
+func (runner *Executor) SetEnvAllowList(allowList string) {
+	runner.envAllow = []string{}
+	for _, name := range strings.Split(allowList, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			runner.envAllow = append(runner.envAllow, name)
+		}
+	}
+}
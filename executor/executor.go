@@ -1,7 +1,9 @@
 package executor
 
 import (
+	"apprunner/extensions"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -18,14 +20,121 @@ import (
 const defaultExitingTimeout = 20 // seconds
 
 type app struct {
-	id     int
-	name   string
-	exitCh chan (funl.Value)
+	id       int
+	name     string
+	replica  int
+	exitCh   chan (funl.Value)
+	done     chan struct{}
+	group    *appGroup
+	restarts int
+	started  time.Time
+	ports    []int
+
+	interpreter *funl.Interpreter
+	inbox       chan funl.Value
+
+	// request handler registered with serve, calls bounds
+	// handler calls in progress
+	handler      funl.Value
+	handlerFrame *funl.Frame
+	calls        chan struct{}
+
+	// topic subscriptions (ended when app exits)
+	subscriptions []chan funl.Value
+
+	lock          sync.Mutex
+	ready         bool
+	lastHeartbeat time.Time
+	stopping      bool
+	restarting    bool
+	orphaned      bool
+	probe         probeState
+
+	// set when app has exited (done is closed)
+	retval  funl.Value
+	failure string
+	rtErr   *rtError
+}
+
+// outcome tells how exited app ended: "failed", "stopped" or "succeeded"
+func (a *app) outcome() string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	switch {
+	case a.failure != "":
+		return "failed"
+	case a.stopping:
+		return "stopped"
+	}
+	return "succeeded"
+}
+
+// appSpec contains everything needed for starting
+// new instance of app
+type appSpec struct {
+	pack           string
+	code           []byte
+	args           []*funl.Item
+	haveCTXasFirst bool
+	haveCTXasLast  bool
+
+	readySignal      bool
+	heartbeatTimeout time.Duration
+	restartPolicy    string
+	probe            *httpProbe
+	route            *appRoute
+	ports            int
+	config           funl.Value
+	secrets          map[string]string
+	env              map[string]string
+	modules          []string
+}
+
+// appGroup is set of identical app instances (replicas)
+// started from same spec, only group created with replicas
+// has unique name by which it can be scaled
+type appGroup struct {
+	name     string
+	named    bool
+	kind     string // empty for apps, groupJob or groupSchedule
+	spec     *appSpec
+	replicas int
+	stats    *routeStats
+}
+
+// kinds of groups which are not started as apps
+const (
+	groupJob      = "job"
+	groupSchedule = "schedule"
+)
+
+// identity returns name by which instances of group are identified for extensions
+// (apps by name, jobs and schedules by kind and name so that those can't be mixed),
+// app name containing ':' is prefixed with 'app:' and app without name has no identity
+func (grp *appGroup) identity() string {
+	switch {
+	case grp.kind != "":
+		return grp.kind + ":" + grp.name
+	case strings.Contains(grp.name, ":"):
+		return "app:" + grp.name
+	}
+	return grp.name
 }
 
 type appStore struct {
-	m    map[int]*app
-	lock sync.RWMutex
+	m       map[int]*app
+	groups  map[*appGroup]bool
+	idCount int
+	lock    sync.RWMutex
+}
+
+func (aps *appStore) newID() int {
+	aps.lock.Lock()
+	defer aps.lock.Unlock()
+
+	aps.idCount++
+	return aps.idCount
 }
 
 func (aps *appStore) getAll() []*app {
@@ -48,15 +157,35 @@ func (aps *appStore) stop(appID int) error {
 	if !found {
 		return fmt.Errorf("app not found")
 	}
+	appInstance.lock.Lock()
+	appInstance.stopping = true
+	appInstance.lock.Unlock()
+
+	aps.sendExit(appInstance, "exit-from-user")
+	return nil
+}
+
+// sendExit sends exit value to app and waits until app has exited,
+// returns false if app did not exit in time (or cannot be stopped)
+func (aps *appStore) sendExit(appInstance *app, reason string) bool {
 	if appInstance.exitCh == nil {
-		return nil
+		return false
+	}
+	timeout := time.After(defaultExitingTimeout * time.Second)
+	select {
+	case appInstance.exitCh <- funl.Value{Kind: funl.StringValue, Data: reason}:
+	case <-appInstance.done:
+		return true
+	case <-timeout:
+		return false
 	}
-	appInstance.exitCh <- funl.Value{Kind: funl.StringValue, Data: "exit-from-user"}
 	select {
 	case <-appInstance.exitCh:
-	case <-time.After(defaultExitingTimeout * time.Second):
+	case <-appInstance.done:
+	case <-timeout:
+		return false
 	}
-	return nil
+	return true
 }
 
 func (aps *appStore) add(appInstance *app) error {
@@ -72,9 +201,176 @@ func (aps *appStore) del(appInstance *app) error {
 	defer aps.lock.Unlock()
 
 	delete(aps.m, appInstance.id)
+
+	// group is removed when its last instance exits by itself,
+	// group scaled to zero replicas is kept so that it can be scaled up again
+	grp := appInstance.group
+	if grp == nil || grp.replicas == 0 || !aps.groups[grp] {
+		return nil
+	}
+	appInstance.lock.Lock()
+	restarting := appInstance.restarting
+	appInstance.lock.Unlock()
+	if restarting {
+		return nil
+	}
+	for _, appData := range aps.m {
+		if appData.group == grp {
+			return nil
+		}
+	}
+	delete(aps.groups, grp)
 	return nil
 }
 
+func (aps *appStore) addGroup(grp *appGroup) error {
+	aps.lock.Lock()
+	defer aps.lock.Unlock()
+
+	if grp.named {
+		if _, found := aps.findGroup(grp.name); found {
+			return fmt.Errorf("app group already exists: %s", grp.name)
+		}
+	}
+	if aps.hasRouteConflict(grp) {
+		return fmt.Errorf("route already used: %s%s", grp.spec.route.Host, grp.spec.route.Prefix)
+	}
+	aps.groups[grp] = true
+	return nil
+}
+
+func (aps *appStore) delGroup(grp *appGroup) {
+	aps.lock.Lock()
+	defer aps.lock.Unlock()
+
+	delete(aps.groups, grp)
+}
+
+// findGroup returns named group, assumed to be called with lock held
+func (aps *appStore) findGroup(name string) (*appGroup, bool) {
+	for grp := range aps.groups {
+		if grp.named && grp.name == name {
+			return grp, true
+		}
+	}
+	return nil, false
+}
+
+// getGroup returns named group (created with replicas)
+func (aps *appStore) getGroup(name string) (*appGroup, bool) {
+	aps.lock.RLock()
+	defer aps.lock.RUnlock()
+
+	return aps.findGroup(name)
+}
+
+// hasGroup tells whether group still exists
+func (aps *appStore) hasGroup(grp *appGroup) bool {
+	aps.lock.RLock()
+	defer aps.lock.RUnlock()
+
+	return aps.groups[grp]
+}
+
+// hasGroupWithName tells whether some group (named or not) has given name
+func (aps *appStore) hasGroupWithName(name string) bool {
+	aps.lock.RLock()
+	defer aps.lock.RUnlock()
+
+	for grp := range aps.groups {
+		if grp.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (aps *appStore) getGroups() []*appGroup {
+	groups := []*appGroup{}
+
+	aps.lock.RLock()
+	defer aps.lock.RUnlock()
+
+	for grp := range aps.groups {
+		groups = append(groups, grp)
+	}
+	return groups
+}
+
+// groupState returns wanted replica count and running instances of group
+func (aps *appStore) groupState(grp *appGroup) (replicas int, apps []*app) {
+	aps.lock.RLock()
+	defer aps.lock.RUnlock()
+
+	for _, appData := range aps.m {
+		if appData.group == grp {
+			apps = append(apps, appData)
+		}
+	}
+	return grp.replicas, apps
+}
+
+// getGroupApps returns running instances of group
+func (aps *appStore) getGroupApps(grp *appGroup) []*app {
+	apps := []*app{}
+
+	aps.lock.RLock()
+	defer aps.lock.RUnlock()
+
+	for _, appData := range aps.m {
+		if appData.group == grp {
+			apps = append(apps, appData)
+		}
+	}
+	return apps
+}
+
+// missingReplicas returns wanted replica count of group and
+// replica indexes which are not running
+func (aps *appStore) missingReplicas(grp *appGroup) (replicas int, missing []int) {
+	aps.lock.RLock()
+	defer aps.lock.RUnlock()
+
+	running := map[int]bool{}
+	for _, appData := range aps.m {
+		if appData.group == grp {
+			running[appData.replica] = true
+		}
+	}
+	for i := 0; i < grp.replicas; i++ {
+		if !running[i] {
+			missing = append(missing, i)
+		}
+	}
+	return grp.replicas, missing
+}
+
+// setReplicas sets wanted replica count for group and returns
+// replica indexes which need to be started and instances which need to be stopped
+func (aps *appStore) setReplicas(grp *appGroup, replicas int) (toStart []int, toStop []*app) {
+	aps.lock.Lock()
+	defer aps.lock.Unlock()
+
+	grp.replicas = replicas
+	running := map[int]bool{}
+	for _, appData := range aps.m {
+		if appData.group != grp {
+			continue
+		}
+		if appData.replica >= replicas {
+			toStop = append(toStop, appData)
+		} else {
+			running[appData.replica] = true
+		}
+	}
+	for i := 0; i < replicas; i++ {
+		if !running[i] {
+			toStart = append(toStart, i)
+		}
+	}
+	return
+}
+
 func newArgEvaluator() *argEval {
 	interpreter := funl.NewInterpreter()
 	if err := std.InitSTD(interpreter); err != nil {
@@ -85,48 +381,120 @@ func newArgEvaluator() *argEval {
 	}
 	frame := funl.NewTopFrameWithInterpreter(interpreter)
 	frame.SetInProcCall(true)
-	evaluatorItem := &funl.Item{
-		Type: funl.ValueItem,
-		Data: funl.Value{
-			Kind: funl.StringValue,
-			Data: "call(proc() import stdjson stdjson.decode end)",
-		},
+	getEvaluator := func(source string) funl.Value {
+		evaluatorItem := &funl.Item{
+			Type: funl.ValueItem,
+			Data: funl.Value{
+				Kind: funl.StringValue,
+				Data: source,
+			},
+		}
+		return funl.HandleEvalOP(frame, []*funl.Item{evaluatorItem})
 	}
-	evaluator := funl.HandleEvalOP(frame, []*funl.Item{evaluatorItem})
 
 	return &argEval{
-		argEvaluator: evaluator,
-		frame:        frame,
+		argEvaluator:  getEvaluator("call(proc() import stdjson stdjson.decode end)"),
+		valEncoder:    getEvaluator("call(proc() import stdjson stdjson.encode end)"),
+		bytesToString: getEvaluator("call(proc() import stdbytes stdbytes.string end)"),
+		frame:         frame,
 	}
 }
 
 type argEval struct {
-	argEvaluator funl.Value
-	frame        *funl.Frame
+	argEvaluator  funl.Value
+	valEncoder    funl.Value
+	bytesToString funl.Value
+	frame         *funl.Frame
 }
 
-func newAppStore() *appStore {
+// encodeJSON encodes FunL value to JSON
+func (ae *argEval) encodeJSON(val funl.Value) ([]byte, error) {
+	operands := []*funl.Item{
+		&funl.Item{
+			Type: funl.ValueItem,
+			Data: ae.valEncoder,
+		},
+		&funl.Item{
+			Type: funl.ValueItem,
+			Data: val,
+		},
+	}
+	resit := funl.NewListIterator(funl.HandleCallOP(ae.frame, operands))
+	okv := resit.Next()
+	errv := resit.Next()
+	if !(*okv).Data.(bool) {
+		return nil, fmt.Errorf("%s", (*errv).Data.(string))
+	}
+	operands = []*funl.Item{
+		&funl.Item{
+			Type: funl.ValueItem,
+			Data: ae.bytesToString,
+		},
+		&funl.Item{
+			Type: funl.ValueItem,
+			Data: *resit.Next(),
+		},
+	}
+	strv := funl.HandleCallOP(ae.frame, operands)
+	return []byte(strv.Data.(string)), nil
+}
+
+// decodeJSON decodes JSON to FunL value
+func (ae *argEval) decodeJSON(data []byte) (funl.Value, error) {
+	operands := []*funl.Item{
+		&funl.Item{
+			Type: funl.ValueItem,
+			Data: ae.argEvaluator,
+		},
+		&funl.Item{
+			Type: funl.ValueItem,
+			Data: funl.Value{
+				Kind: funl.OpaqueValue,
+				Data: std.NewOpaqueByteArray(data),
+			},
+		},
+	}
+	resit := funl.NewListIterator(funl.HandleCallOP(ae.frame, operands))
+	okv := resit.Next()
+	errv := resit.Next()
+	if (*okv).Kind != funl.BoolValue || !(*okv).Data.(bool) {
+		return funl.Value{}, fmt.Errorf("%v", (*errv).Data)
+	}
+	return *resit.Next(), nil
+}
+
+func newAppStore(idStart int) *appStore {
 	return &appStore{
-		m: map[int]*app{},
+		m:       map[int]*app{},
+		groups:  map[*appGroup]bool{},
+		idCount: idStart,
 	}
 }
 
-type packRunner struct {
+// Executor represents executor (runs app's)
+type Executor struct {
 	csAddr     string
 	packGetter func(string) ([]byte, bool)
-	idCount    int
 	appstore   *appStore
 	argsEval   *argEval
+	schedules  *scheduleStore
+	jobs       *jobStore
+	functions  *functionStore
+	ports      *portPool
+	configs    *configStore
+	envAllow   []string
+	modules    []string
+	sandbox    *sandbox
+	exits      *exitStore
+	callCount  uint64
+	topics     *topicHub
+	dataDir    string
 }
 
-func (runner *packRunner) handleGetAll(w http.ResponseWriter, r *http.Request) {
+func (runner *Executor) handleGetAll(w http.ResponseWriter, r *http.Request) {
 	appsResp := []map[string]interface{}{}
 	for _, app := range runner.appstore.getAll() {
-		appInfo := map[string]interface{}{
-			"id":   app.id,
-			"name": app.name,
-		}
-		appsResp = append(appsResp, appInfo)
+		appsResp = append(appsResp, app.info())
 	}
 	resp, err := json.Marshal(&appsResp)
 	if err != nil {
@@ -138,7 +506,7 @@ func (runner *packRunner) handleGetAll(w http.ResponseWriter, r *http.Request) {
 	w.Write(resp)
 }
 
-func (runner *packRunner) handleDelete(w http.ResponseWriter, r *http.Request) {
+func (runner *Executor) handleDelete(w http.ResponseWriter, r *http.Request) {
 	pathParts := strings.Split(r.URL.Path, "/")
 	appID := pathParts[len(pathParts)-1]
 	if appID == "" {
@@ -157,13 +525,75 @@ func (runner *packRunner) handleDelete(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (runner *packRunner) handleAppCreate(w http.ResponseWriter, r *http.Request) {
+// getPack gets package content from code server
+func (runner *Executor) getPack(packName string) ([]byte, bool) {
+	if runner.csAddr == "" {
+		return runner.packGetter(packName)
+	}
+	code, err := func() ([]byte, error) {
+		client := &http.Client{}
+		resp, err := client.Get(fmt.Sprintf("http://%s/packs/%s", runner.csAddr, packName))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("Error from codeserver: %d: %s", resp.StatusCode, string(body))
+		}
+		return body, nil
+	}()
+	if err != nil {
+		log.Printf("Error in getting package: %v", err)
+		return nil, false
+	}
+	return code, true
+}
+
+// decodeArgs decodes JSON array to arguments of main procedure
+func (runner *Executor) decodeArgs(jsonArgs []byte) ([]*funl.Item, error) {
+	argListVal, err := runner.argsEval.decodeJSON(jsonArgs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request")
+	}
+	if argListVal.Kind != funl.ListValue {
+		return nil, fmt.Errorf("arguments should be in array")
+	}
+	lit := funl.NewListIterator(argListVal)
+	args := []*funl.Item{}
+	for {
+		nextArg := lit.Next()
+		if nextArg == nil {
+			break
+		}
+		args = append(args, &funl.Item{Type: funl.ValueItem, Data: *nextArg})
+	}
+	return args, nil
+}
+
+func (runner *Executor) handleAppCreate(w http.ResponseWriter, r *http.Request) {
 	type runRequest struct {
 		Name           string          `json:"name"`
 		Pack           string          `json:"pack"`
 		Args           json.RawMessage `json:"args"`
 		HaveCTXasLast  bool            `json:"ctx-last"`
 		HaveCTXasFirst bool            `json:"ctx-1st"`
+		Replicas       *int            `json:"replicas"`
+		ReadySignal    bool            `json:"ready-signal"`
+		HeartbeatTmo   int             `json:"heartbeat-timeout"`
+		Restart        string          `json:"restart"`
+		Probe          *httpProbe      `json:"probe"`
+		Route          *appRoute       `json:"route"`
+		Ports          int             `json:"ports"`
+		Config         string          `json:"config"`
+		Secrets        string          `json:"secrets"`
+		Env            *envSpec        `json:"env"`
+		ArgsFunl       string          `json:"args-funl"`
+		Settle         int             `json:"settle"`
+		Modules        []string        `json:"modules"`
 	}
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -176,87 +606,235 @@ func (runner *packRunner) handleAppCreate(w http.ResponseWriter, r *http.Request
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	var code []byte
-	var packFound bool
-	if runner.csAddr == "" {
-		code, packFound = runner.packGetter(req.Pack)
-	} else {
-		code, err = func() ([]byte, error) {
-			client := &http.Client{}
-			resp, err := client.Get(fmt.Sprintf("http://%s/packs/%s", runner.csAddr, req.Pack))
-			if err != nil {
-				return nil, err
-			}
-			defer resp.Body.Close()
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return nil, err
-			}
-			if resp.StatusCode != 200 {
-				return nil, fmt.Errorf("Error from codeserver: %d: %s", resp.StatusCode, string(body))
-			}
-			return body, nil
-		}()
-		if err != nil {
-			log.Printf("Error in getting package: %v", err)
-		} else {
-			packFound = true
+	if req.Name != "" {
+		if err := runner.checkDataDirName(req.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	// app group (with unique name) is created only if replicas is given
+	replicas := 1
+	if req.Replicas != nil {
+		if req.Name == "" {
+			http.Error(w, "app name assumed for replicas", http.StatusBadRequest)
+			return
+		}
+		if *req.Replicas < 0 {
+			http.Error(w, "replicas should not be negative", http.StatusBadRequest)
+			return
+		}
+		if *req.Replicas > 0 {
+			replicas = *req.Replicas
+		}
+	}
+	if req.HeartbeatTmo < 0 {
+		http.Error(w, "heartbeat-timeout should not be negative", http.StatusBadRequest)
+		return
+	}
+	if req.Restart == "" {
+		req.Restart = restartNever
+	}
+	if !isValidRestartPolicy(req.Restart) {
+		http.Error(w, fmt.Sprintf("invalid restart policy: %s", req.Restart), http.StatusBadRequest)
+		return
+	}
+	if req.Settle < 0 || req.Settle > maxSettle {
+		http.Error(w, fmt.Sprintf("settle should be between 0 and %d", maxSettle), http.StatusBadRequest)
+		return
+	}
+	if req.Ports < 0 {
+		http.Error(w, "ports should not be negative", http.StatusBadRequest)
+		return
+	}
+	if !req.HaveCTXasFirst && !req.HaveCTXasLast {
+		// app without context can't be asked to exit or signal readiness/heartbeat
+		switch {
+		case req.Restart != restartNever:
+			http.Error(w, "restart policy requires ctx-1st or ctx-last", http.StatusBadRequest)
+			return
+		case req.HeartbeatTmo > 0:
+			http.Error(w, "heartbeat-timeout requires ctx-1st or ctx-last", http.StatusBadRequest)
+			return
+		case req.ReadySignal:
+			http.Error(w, "ready-signal requires ctx-1st or ctx-last", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Probe != nil {
+		if err := req.Probe.validate(req.Ports > 0); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Route != nil {
+		if err := req.Route.validate(req.Ports > 0); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 	}
+	if req.Ports > 0 && runner.ports.free() < req.Ports*replicas {
+		http.Error(w, "not enough free ports", http.StatusServiceUnavailable)
+		return
+	}
+
+	code, packFound := runner.getPack(req.Pack)
 	if !packFound {
 		http.Error(w, "package not found", http.StatusNotFound)
 		return
 	}
-
-	// Decode arguments
-	item := &funl.Item{
-		Type: funl.ValueItem,
-		Data: funl.Value{
-			Kind: funl.OpaqueValue,
-			Data: std.NewOpaqueByteArray(req.Args),
-		},
+	if err := checkModuleNames(req.Modules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	operands := []*funl.Item{
-		&funl.Item{
-			Type: funl.ValueItem,
-			Data: runner.argsEval.argEvaluator,
-		},
-		item,
+	modules, err := runner.allowedModules(code, req.Modules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
 	}
-	argListVal := funl.HandleCallOP(runner.argsEval.frame, operands)
-	if argListVal.Kind != funl.ListValue {
-		http.Error(w, "arguments should be in array", http.StatusBadRequest)
+	if err := validatePack(req.Pack, code, modules); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
-	resit := funl.NewListIterator(argListVal)
-	resv := resit.Next()
-	if (*resv).Kind != funl.BoolValue || !(*resv).Data.(bool) {
-		http.Error(w, "invalid request", http.StatusBadRequest)
+	var args []*funl.Item
+	if req.ArgsFunl != "" {
+		if req.Args != nil {
+			http.Error(w, "either args or args-funl assumed", http.StatusBadRequest)
+			return
+		}
+		if args, err = runner.sandbox.evalArgs(req.ArgsFunl); err != nil {
+			status := http.StatusUnprocessableEntity
+			if errors.Is(err, extensions.ErrEvalBusy) {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, fmt.Sprintf("args-funl evaluation failed: %v", err), status)
+			return
+		}
+	} else {
+		var status int
+		if args, status, err = runner.makeArgs(code, req.Args); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+	config, secrets, status, err := runner.getAppConfig(req.Config, req.Secrets)
+	if err != nil {
+		http.Error(w, err.Error(), status)
 		return
 	}
-	resv = resit.Next()
-	resv = resit.Next()
-	lit := funl.NewListIterator(*resv)
-	args := []*funl.Item{}
-	for {
-		nextArg := lit.Next()
-		if nextArg == nil {
-			break
+	env, err := runner.resolveEnv(req.Env)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	grp := &appGroup{
+		name:  req.Name,
+		named: req.Replicas != nil,
+		spec: &appSpec{
+			pack:           req.Pack,
+			code:           code,
+			args:           args,
+			haveCTXasFirst: req.HaveCTXasFirst,
+			haveCTXasLast:  req.HaveCTXasLast,
+
+			readySignal:      req.ReadySignal,
+			heartbeatTimeout: time.Duration(req.HeartbeatTmo) * time.Second,
+			restartPolicy:    req.Restart,
+			probe:            req.Probe,
+			route:            req.Route,
+			ports:            req.Ports,
+			config:           config,
+			secrets:          secrets,
+			env:              env,
+			modules:          modules,
+		},
+		replicas: replicas,
+		stats:    newRouteStats(),
+	}
+	if err := runner.appstore.addGroup(grp); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	ids := []string{}
+	instances := []*app{}
+	for replica := 0; replica < replicas; replica++ {
+		appInstance := runner.startApp(grp, replica, replicas, 0)
+		ids = append(ids, fmt.Sprintf("%d", appInstance.id))
+		instances = append(instances, appInstance)
+	}
+	if req.Settle > 0 {
+		if failure := settle(instances, time.Duration(req.Settle)*time.Second); failure != "" {
+			runner.removeGroup(grp)
+			http.Error(w, fmt.Sprintf("app failed during startup: %s", failure), http.StatusUnprocessableEntity)
+			return
 		}
-		args = append(args, &funl.Item{Type: funl.ValueItem, Data: *nextArg})
 	}
 
+	response := map[string]interface{}{
+		"id":  ids[0],
+		"ids": ids,
+	}
+	resp, err := json.Marshal(&response)
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+}
+
+// ctxEntry makes key-value operands for context map
+func ctxEntry(key string, value funl.Value) []*funl.Item {
+	return []*funl.Item{
+		&funl.Item{
+			Type: funl.ValueItem,
+			Data: funl.Value{
+				Kind: funl.StringValue,
+				Data: key,
+			},
+		},
+		&funl.Item{
+			Type: funl.ValueItem,
+			Data: value,
+		},
+	}
+}
+
+// startApp creates new app instance for given replica of group
+// and runs it in own goroutine
+func (runner *Executor) startApp(grp *appGroup, replica, replicas, restarts int) *app {
+	spec := grp.spec
+
 	// create app instance
-	runner.idCount++
+	now := time.Now()
 	appInstance := &app{
-		id:   runner.idCount,
-		name: req.Name,
+		id:            runner.appstore.newID(),
+		name:          grp.name,
+		replica:       replica,
+		done:          make(chan struct{}),
+		group:         grp,
+		restarts:      restarts,
+		started:       now,
+		ready:         !spec.readySignal,
+		lastHeartbeat: now,
+		inbox:         make(chan funl.Value, inboxSize),
+		calls:         make(chan struct{}, maxServerCalls),
+	}
+	var portErr error
+	if spec.ports > 0 {
+		appInstance.ports, portErr = runner.ports.alloc(spec.ports, appInstance.id)
+	}
+	var dataDir string
+	var dataErr error
+	if runner.dataDir != "" && grp.name != "" {
+		dataDir, dataErr = runner.makeAppDataDir(grp.name)
 	}
-	runner.appstore.add(appInstance)
 
 	cargs := []*funl.Item{}
-	if req.HaveCTXasLast || req.HaveCTXasFirst {
+	if spec.haveCTXasLast || spec.haveCTXasFirst {
 		// add also context map
 		channel := make(chan funl.Value)
 		chanVal := funl.Value{Kind: funl.ChanValue, Data: channel}
@@ -268,138 +846,284 @@ func (runner *packRunner) handleAppCreate(w http.ResponseWriter, r *http.Request
 			for _, v := range ops {
 				largs = append(largs, v)
 			}
-			fmt.Println(largs...)
+			fmt.Print(maskSecrets(fmt.Sprintln(largs...), spec.secrets))
 			return funl.Value{Kind: funl.BoolValue, Data: true}
 		}
-		operands = []*funl.Item{
-			&funl.Item{
-				Type: funl.ValueItem,
-				Data: funl.Value{
-					Kind: funl.StringValue,
-					Data: "exit-chan",
-				},
-			},
-			&funl.Item{
-				Type: funl.ValueItem,
-				Data: chanVal,
-			},
-			&funl.Item{
-				Type: funl.ValueItem,
-				Data: funl.Value{
-					Kind: funl.StringValue,
-					Data: "id",
-				},
-			},
-			&funl.Item{
-				Type: funl.ValueItem,
-				Data: funl.Value{
-					Kind: funl.StringValue,
-					Data: fmt.Sprintf("%d", appInstance.id),
-				},
-			},
-			&funl.Item{
-				Type: funl.ValueItem,
-				Data: funl.Value{
-					Kind: funl.StringValue,
-					Data: "name",
-				},
-			},
-			&funl.Item{
-				Type: funl.ValueItem,
-				Data: funl.Value{
-					Kind: funl.StringValue,
-					Data: appInstance.name,
-				},
-			},
-			&funl.Item{
-				Type: funl.ValueItem,
-				Data: funl.Value{
-					Kind: funl.StringValue,
-					Data: "log",
-				},
-			},
-			&funl.Item{
-				Type: funl.ValueItem,
-				Data: funl.Value{
-					Kind: funl.ExtProcValue,
-					Data: funl.ExtProcType{Impl: loggerProc},
-				},
-			},
+		operands := []*funl.Item{}
+		operands = append(operands, ctxEntry("exit-chan", chanVal)...)
+		operands = append(operands, ctxEntry("id", funl.Value{Kind: funl.StringValue, Data: fmt.Sprintf("%d", appInstance.id)})...)
+		operands = append(operands, ctxEntry("name", funl.Value{Kind: funl.StringValue, Data: appInstance.name})...)
+		operands = append(operands, ctxEntry("log", funl.Value{Kind: funl.ExtProcValue, Data: funl.ExtProcType{Impl: loggerProc}})...)
+		operands = append(operands, ctxEntry("replica", funl.Value{Kind: funl.IntValue, Data: replica})...)
+		operands = append(operands, ctxEntry("replicas", funl.Value{Kind: funl.IntValue, Data: replicas})...)
+		operands = append(operands, ctxEntry("set-ready", funl.Value{Kind: funl.ExtProcValue, Data: funl.ExtProcType{Impl: appInstance.getSetReadyProc()}})...)
+		operands = append(operands, ctxEntry("heartbeat", funl.Value{Kind: funl.ExtProcValue, Data: funl.ExtProcType{Impl: appInstance.getHeartbeatProc()}})...)
+		portValues := []funl.Value{}
+		for _, port := range appInstance.ports {
+			portValues = append(portValues, funl.Value{Kind: funl.IntValue, Data: port})
+		}
+		operands = append(operands, ctxEntry("ports", funl.MakeListOfValues(runner.argsEval.frame, portValues))...)
+		config := spec.config
+		if config.Kind != funl.MapValue {
+			config = funl.HandleMapOP(runner.argsEval.frame, []*funl.Item{})
+		}
+		operands = append(operands, ctxEntry("config", config)...)
+		operands = append(operands, ctxEntry("env", makeStringMap(runner.argsEval.frame, spec.env))...)
+		operands = append(operands, ctxEntry("secrets", funl.Value{Kind: funl.ExtProcValue, Data: funl.ExtProcType{Impl: runner.getSecretsProc(spec.secrets)}})...)
+		operands = append(operands, ctxEntry("inbox", funl.Value{Kind: funl.ChanValue, Data: appInstance.inbox})...)
+		operands = append(operands, ctxEntry("send", funl.Value{Kind: funl.ExtProcValue, Data: funl.ExtProcType{Impl: runner.getSendProc(appInstance)}})...)
+		operands = append(operands, ctxEntry("serve", funl.Value{Kind: funl.ExtProcValue, Data: funl.ExtProcType{Impl: appInstance.getServeProc()}})...)
+		operands = append(operands, ctxEntry("call-app", funl.Value{Kind: funl.ExtProcValue, Data: funl.ExtProcType{Impl: runner.getCallAppProc(appInstance)}})...)
+		if runner.dataDir != "" {
+			operands = append(operands, ctxEntry("data-dir", funl.Value{Kind: funl.StringValue, Data: dataDir})...)
+		}
+		if runner.topics != nil {
+			operands = append(operands, ctxEntry("broker", runner.topics.broker)...)
+			operands = append(operands, ctxEntry("broker-name", funl.Value{Kind: funl.StringValue, Data: runner.topics.name})...)
+			operands = append(operands, ctxEntry("publish", funl.Value{Kind: funl.ExtProcValue, Data: funl.ExtProcType{Impl: runner.getPublishProc()}})...)
+			operands = append(operands, ctxEntry("subscribe", funl.Value{Kind: funl.ExtProcValue, Data: funl.ExtProcType{Impl: runner.getSubscribeProc(appInstance)}})...)
+			operands = append(operands, ctxEntry("unsubscribe", funl.Value{Kind: funl.ExtProcValue, Data: funl.ExtProcType{Impl: runner.getUnsubscribeProc()}})...)
 		}
 		mapv := funl.HandleMapOP(runner.argsEval.frame, operands)
-		if req.HaveCTXasFirst {
+		if spec.haveCTXasFirst {
 			// add ctx as first argument
-			cargs = append([]*funl.Item{&funl.Item{Type: funl.ValueItem, Data: mapv}}, args...)
+			cargs = append([]*funl.Item{&funl.Item{Type: funl.ValueItem, Data: mapv}}, spec.args...)
 		} else {
 			// add ctx as last argument
-			cargs = append(args, &funl.Item{Type: funl.ValueItem, Data: mapv})
+			cargs = append(append([]*funl.Item{}, spec.args...), &funl.Item{Type: funl.ValueItem, Data: mapv})
 		}
 	} else {
 		// no ctx given as argument
-		cargs = args
+		cargs = spec.args
 	}
+	runner.appstore.add(appInstance)
 
 	// run app in own goroutine and interpreter
 	go func(thisApp *app) {
-		defer func() {
-			if thisApp.exitCh != nil {
-				close(thisApp.exitCh)
-			}
-		}()
+		failed := true
 		defer func() {
 			if r := recover(); r != nil {
-				fmt.Println(fmt.Sprintf("App runtime error:  %d (%s): %v", thisApp.id, thisApp.name, r))
+				rtErr := newRTError(r)
+				rtErr.Message = maskSecrets(rtErr.Message, spec.secrets)
+				thisApp.rtErr = rtErr
+				thisApp.failure = rtErr.Message
+				fmt.Println(fmt.Sprintf("App runtime error:  %d (%s): %s", thisApp.id, thisApp.name, thisApp.failure))
+			}
+			runner.ports.release(thisApp.ports)
+			if runner.topics != nil {
+				runner.endSubscriptions(thisApp)
+			}
+			if thisApp.interpreter != nil {
+				extensions.ClearAppIdentity(thisApp.interpreter)
+				extensions.RemoveAppWatchers(thisApp.interpreter)
+				clearModuleAllowList(thisApp.interpreter)
+			}
+			runner.exits.add(thisApp)
+			restart := runner.takeRestart(thisApp, failed)
+			runner.appstore.del(thisApp)
+			close(thisApp.done)
+			if restart {
+				runner.restartReplica(thisApp)
 			}
 		}()
-		defer runner.appstore.del(thisApp)
 
-		retval, err := funl.FunlMainWithPackageContent(code, cargs, "main", req.Pack, std.InitSTD)
+		if portErr != nil {
+			panic(portErr)
+		}
+		if dataErr != nil {
+			panic(dataErr)
+		}
+		// identity of app is given for extensions (appval access control)
+		initSTD := func(interpreter *funl.Interpreter) error {
+			thisApp.interpreter = interpreter
+			extensions.SetAppIdentity(interpreter, grp.identity())
+			if dataDir != "" {
+				extensions.SetAppDataDir(interpreter, dataDir)
+			}
+			return getInitSTD(spec.modules)(interpreter)
+		}
+		retval, err := funl.FunlMainWithPackageContent(spec.code, cargs, "main", spec.pack, initSTD)
 		if err != nil {
 			panic(err)
 		}
+		failed = false
+		thisApp.retval = retval
 
-		fmt.Println(fmt.Sprintf("App exit: %d (%s): %#v", thisApp.id, thisApp.name, retval))
+		fmt.Println(maskSecrets(fmt.Sprintf("App exit: %d (%s): %#v", thisApp.id, thisApp.name, retval), spec.secrets))
 	}(appInstance)
 
-	response := map[string]interface{}{
-		"id": fmt.Sprintf("%d", appInstance.id),
+	if spec.probe != nil {
+		go runner.runProbe(appInstance)
 	}
-	resp, err := json.Marshal(&response)
+
+	return appInstance
+}
+
+func (runner *Executor) handleGroupGetAll(w http.ResponseWriter, r *http.Request) {
+	groupsResp := []map[string]interface{}{}
+	for _, grp := range runner.appstore.getGroups() {
+		if !grp.named {
+			continue
+		}
+		replicas, apps := runner.appstore.groupState(grp)
+		ids := []int{}
+		for _, appData := range apps {
+			ids = append(ids, appData.id)
+		}
+		grpInfo := map[string]interface{}{
+			"name":     grp.name,
+			"pack":     grp.spec.pack,
+			"replicas": replicas,
+			"ids":      ids,
+		}
+		groupsResp = append(groupsResp, grpInfo)
+	}
+	resp, err := json.Marshal(&groupsResp)
 	if err != nil {
-		log.Printf("%v", err)
+		log.Printf("Error in reading app groups: %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
 	w.Write(resp)
 }
 
-// GetHandler gets handler
-func GetHandler(csAddr string, packGetter func(string) ([]byte, bool)) (hCol, hRes func(w http.ResponseWriter, r *http.Request)) {
+func (runner *Executor) handleGroupPatch(w http.ResponseWriter, r *http.Request) {
+	type patchRequest struct {
+		Replicas *int `json:"replicas"`
+	}
+	pathParts := strings.Split(r.URL.Path, "/")
+	name := pathParts[len(pathParts)-1]
+	grp, found := runner.appstore.getGroup(name)
+	if !found {
+		http.Error(w, "app group not found", http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req patchRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Replicas == nil || *req.Replicas < 0 {
+		http.Error(w, "replicas (non-negative) assumed", http.StatusBadRequest)
+		return
+	}
+
+	toStart, toStop := runner.appstore.setReplicas(grp, *req.Replicas)
+	for _, replica := range toStart {
+		runner.startApp(grp, replica, *req.Replicas, 0)
+	}
+	var wg sync.WaitGroup
+	for _, appData := range toStop {
+		wg.Add(1)
+		go func(appID int) {
+			defer wg.Done()
+			runner.appstore.stop(appID)
+		}(appData.id)
+	}
+	wg.Wait()
+}
+
+func (runner *Executor) handleGroupDelete(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	name := pathParts[len(pathParts)-1]
+	grp, found := runner.appstore.getGroup(name)
+	if !found {
+		http.Error(w, "app group not found", http.StatusNotFound)
+		return
+	}
+	runner.removeGroup(grp)
+
+	if r.URL.Query().Get("wipe-data") == "true" {
+		if status, err := runner.wipeAppData(name); err != nil && status != http.StatusNotFound {
+			http.Error(w, fmt.Sprintf("app data not wiped: %v", err), status)
+		}
+	}
+}
+
+// removeGroup stops all instances of group and removes group
+func (runner *Executor) removeGroup(grp *appGroup) {
+	_, toStop := runner.appstore.setReplicas(grp, 0)
+	runner.appstore.delGroup(grp)
+
+	var wg sync.WaitGroup
+	for _, appData := range toStop {
+		wg.Add(1)
+		go func(appID int) {
+			defer wg.Done()
+			runner.appstore.stop(appID)
+		}(appData.id)
+	}
+	wg.Wait()
+}
+
+// NewExecutor returns new executor instance
+func NewExecutor(csAddr string, packGetter func(string) ([]byte, bool)) *Executor {
 	funl.PrintingRTElocationAndScopeEnabled = true
-	server := &packRunner{
+	runner := &Executor{
 		csAddr:     csAddr,
 		packGetter: packGetter,
-		idCount:    10,
-		appstore:   newAppStore(),
+		appstore:   newAppStore(10),
 		argsEval:   newArgEvaluator(),
+		schedules:  newScheduleStore(),
+		jobs:       newJobStore(),
+		functions:  newFunctionStore(),
+		ports:      newPortPool(),
+		sandbox:    newSandbox(),
+		exits:      newExitStore(),
 	}
+	extensions.SetValueEvaluator(runner.sandbox.eval)
+	go runner.supervise()
+	return runner
+}
 
+// GetHandler gets handler
+func (runner *Executor) GetHandler() (hCol, hRes func(w http.ResponseWriter, r *http.Request)) {
 	hCol = func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "POST":
-			server.handleAppCreate(w, r)
+			runner.handleAppCreate(w, r)
+		case "GET":
+			runner.handleGetAll(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+	hRes = func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "DELETE":
+			runner.handleDelete(w, r)
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/messages"):
+			runner.handleAppMessage(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+	return
+}
+
+// GetGroupHandler gets handler for app groups
+func (runner *Executor) GetGroupHandler() (hCol, hRes func(w http.ResponseWriter, r *http.Request)) {
+	hCol = func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
 		case "GET":
-			server.handleGetAll(w, r)
+			runner.handleGroupGetAll(w, r)
 		default:
 			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
 		}
 	}
 	hRes = func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
+		case "PATCH":
+			runner.handleGroupPatch(w, r)
 		case "DELETE":
-			server.handleDelete(w, r)
+			runner.handleGroupDelete(w, r)
 		default:
 			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
 		}
@@ -0,0 +1,87 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultExitHistory = 100
+
+// exitRecord is termination record of app instance
+type exitRecord struct {
+	ID       int      `json:"id"`
+	Name     string   `json:"name"`
+	Replica  int      `json:"replica"`
+	Started  string   `json:"started"`
+	Exited   string   `json:"exited"`
+	Status   string   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+	Details  *rtError `json:"error-details,omitempty"`
+	Restarts int      `json:"restarts"`
+}
+
+// exitStore keeps latest termination records
+type exitStore struct {
+	records []*exitRecord
+	lock    sync.RWMutex
+}
+
+func newExitStore() *exitStore {
+	return &exitStore{}
+}
+
+func (es *exitStore) add(a *app) {
+	record := &exitRecord{
+		ID:       a.id,
+		Name:     a.name,
+		Replica:  a.replica,
+		Started:  a.started.Format(time.RFC3339),
+		Exited:   time.Now().Format(time.RFC3339),
+		Status:   a.outcome(),
+		Error:    a.failure,
+		Details:  a.rtErr,
+		Restarts: a.restarts,
+	}
+
+	es.lock.Lock()
+	defer es.lock.Unlock()
+
+	es.records = append(es.records, record)
+	if l := len(es.records); l > defaultExitHistory {
+		es.records = es.records[l-defaultExitHistory:]
+	}
+}
+
+func (es *exitStore) getAll() []*exitRecord {
+	es.lock.RLock()
+	defer es.lock.RUnlock()
+
+	return append([]*exitRecord{}, es.records...)
+}
+
+func (runner *Executor) handleExitGetAll(w http.ResponseWriter, r *http.Request) {
+	resp, err := json.Marshal(runner.exits.getAll())
+	if err != nil {
+		log.Printf("Error in reading app exits: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// GetExitHandler gets handler for reading termination records of apps
+func (runner *Executor) GetExitHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			runner.handleExitGetAll(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+}
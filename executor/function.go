@@ -0,0 +1,380 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/anssihalmeaho/funl/funl"
+	"github.com/anssihalmeaho/funl/std"
+)
+
+const defaultFunctionPool = 4
+
+// fnInstance is pre-initialized interpreter with handler procedure
+type fnInstance struct {
+	handler funl.Value
+	frame   *funl.Frame
+}
+
+// function is package registered as HTTP function,
+// requests are handled by pool of pre-initialized instances
+type function struct {
+	name     string
+	pack     string
+	poolSize int
+	pool     chan *fnInstance
+
+	lock   sync.Mutex
+	calls  int
+	errors int
+}
+
+type functionStore struct {
+	m    map[string]*function
+	lock sync.RWMutex
+}
+
+func newFunctionStore() *functionStore {
+	return &functionStore{
+		m: map[string]*function{},
+	}
+}
+
+func (fs *functionStore) add(fn *function) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if _, found := fs.m[fn.name]; found {
+		return fmt.Errorf("function already exists: %s", fn.name)
+	}
+	fs.m[fn.name] = fn
+	return nil
+}
+
+func (fs *functionStore) get(name string) (*function, bool) {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+
+	fn, found := fs.m[name]
+	return fn, found
+}
+
+func (fs *functionStore) getAll() []*function {
+	functions := []*function{}
+
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+
+	for _, fn := range fs.m {
+		functions = append(functions, fn)
+	}
+	return functions
+}
+
+func (fs *functionStore) del(name string) bool {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	_, found := fs.m[name]
+	delete(fs.m, name)
+	return found
+}
+
+func (fn *function) info() map[string]interface{} {
+	fn.lock.Lock()
+	defer fn.lock.Unlock()
+
+	return map[string]interface{}{
+		"name":   fn.name,
+		"pack":   fn.pack,
+		"pool":   fn.poolSize,
+		"calls":  fn.calls,
+		"errors": fn.errors,
+	}
+}
+
+func (fn *function) count(failed bool) {
+	fn.lock.Lock()
+	defer fn.lock.Unlock()
+
+	fn.calls++
+	if failed {
+		fn.errors++
+	}
+}
+
+// newFnInstance runs main procedure of package which is assumed
+// to return handler procedure (modules is allow-list of builtin modules)
+func newFnInstance(code []byte, args []*funl.Item, pack string, modules []string) (instance *fnInstance, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	retval, err := funl.FunlMainWithPackageContent(code, args, "main", pack, getInitSTD(modules))
+	if err != nil {
+		return nil, err
+	}
+	if retval.Kind != funl.FunctionValue {
+		return nil, fmt.Errorf("main should return handler procedure (got: %s)", retval)
+	}
+	interpreter := retval.Data.(funl.FuncValue).AccessLink.GetTopFrame().Interpreter
+	frame := funl.NewTopFrameWithInterpreter(interpreter)
+	frame.SetInProcCall(true)
+	return &fnInstance{handler: retval, frame: frame}, nil
+}
+
+// makeRequestMap makes map given to handler from HTTP request
+func makeRequestMap(frame *funl.Frame, r *http.Request, path string, body []byte) funl.Value {
+	query := map[string]string{}
+	for k, v := range r.URL.Query() {
+		query[k] = v[0]
+	}
+	headers := map[string]string{}
+	for k, v := range r.Header {
+		headers[k] = v[0]
+	}
+	return makeMap(frame, map[string]funl.Value{
+		"method":  {Kind: funl.StringValue, Data: r.Method},
+		"path":    {Kind: funl.StringValue, Data: path},
+		"query":   makeStringMap(frame, query),
+		"headers": makeStringMap(frame, headers),
+		"body":    {Kind: funl.OpaqueValue, Data: std.NewOpaqueByteArray(body)},
+	})
+}
+
+// call calls handler procedure and writes its response,
+// handler returns either string (body) or map with 'status', 'body' and 'headers'
+func (runner *Executor) callFunction(instance *fnInstance, w http.ResponseWriter, reqv funl.Value) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	operands := []*funl.Item{
+		&funl.Item{Type: funl.ValueItem, Data: instance.handler},
+		&funl.Item{Type: funl.ValueItem, Data: reqv},
+	}
+	respv := funl.HandleCallOP(instance.frame, operands)
+
+	status := http.StatusOK
+	var bodyv funl.Value
+	hasBody := true
+	switch respv.Kind {
+	case funl.StringValue:
+		bodyv = respv
+	case funl.MapValue:
+		entries := mapEntries(instance.frame, respv)
+		if v, found := entries["status"]; found {
+			if v.Kind != funl.IntValue {
+				return fmt.Errorf("status should be int")
+			}
+			status = v.Data.(int)
+		}
+		if v, found := entries["headers"]; found {
+			if v.Kind != funl.MapValue {
+				return fmt.Errorf("headers should be map")
+			}
+			for hk, hv := range mapEntries(instance.frame, v) {
+				if hv.Kind != funl.StringValue {
+					return fmt.Errorf("header value should be string")
+				}
+				w.Header().Set(hk, hv.Data.(string))
+			}
+		}
+		bodyv, hasBody = entries["body"]
+	default:
+		return fmt.Errorf("handler should return string or map (got: %s)", respv)
+	}
+
+	var body []byte
+	switch {
+	case !hasBody:
+	case bodyv.Kind == funl.StringValue:
+		body = []byte(bodyv.Data.(string))
+	case bodyv.Kind == funl.OpaqueValue:
+		operands = []*funl.Item{
+			&funl.Item{Type: funl.ValueItem, Data: runner.argsEval.bytesToString},
+			&funl.Item{Type: funl.ValueItem, Data: bodyv},
+		}
+		body = []byte(funl.HandleCallOP(runner.argsEval.frame, operands).Data.(string))
+	default:
+		return fmt.Errorf("body should be string or bytearray (got: %s)", bodyv)
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+	return nil
+}
+
+func (runner *Executor) handleFunctionCall(w http.ResponseWriter, r *http.Request) {
+	// path is /fn/:name/...
+	pathParts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/fn/"), "/", 2)
+	fn, found := runner.functions.get(pathParts[0])
+	if !found {
+		http.Error(w, "function not found", http.StatusNotFound)
+		return
+	}
+	path := "/"
+	if len(pathParts) > 1 {
+		path += pathParts[1]
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var instance *fnInstance
+	select {
+	case instance = <-fn.pool:
+	case <-r.Context().Done():
+		return
+	}
+	defer func() { fn.pool <- instance }()
+
+	reqv := makeRequestMap(instance.frame, r, path, body)
+	err = runner.callFunction(instance, w, reqv)
+	fn.count(err != nil)
+	if err != nil {
+		log.Printf("Error in function %s: %v", fn.name, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (runner *Executor) handleFunctionCreate(w http.ResponseWriter, r *http.Request) {
+	type functionRequest struct {
+		Name    string          `json:"name"`
+		Pack    string          `json:"pack"`
+		Args    json.RawMessage `json:"args"`
+		Pool    int             `json:"pool"`
+		Modules []string        `json:"modules"`
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req functionRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || strings.Contains(req.Name, "/") {
+		http.Error(w, "valid function name assumed", http.StatusBadRequest)
+		return
+	}
+	if req.Pool < 0 {
+		http.Error(w, "pool should not be negative", http.StatusBadRequest)
+		return
+	}
+	if req.Pool == 0 {
+		req.Pool = defaultFunctionPool
+	}
+	if req.Args == nil {
+		req.Args = json.RawMessage("[]")
+	}
+
+	code, packFound := runner.getPack(req.Pack)
+	if !packFound {
+		http.Error(w, "package not found", http.StatusNotFound)
+		return
+	}
+	if err := checkModuleNames(req.Modules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	modules, err := runner.allowedModules(code, req.Modules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := validatePack(req.Pack, code, modules); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	args, status, err := runner.makeArgs(code, req.Args)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	fn := &function{
+		name:     req.Name,
+		pack:     req.Pack,
+		poolSize: req.Pool,
+		pool:     make(chan *fnInstance, req.Pool),
+	}
+	for i := 0; i < req.Pool; i++ {
+		instance, err := newFnInstance(code, args, req.Pack, modules)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("function init failed: %v", err), http.StatusUnprocessableEntity)
+			return
+		}
+		fn.pool <- instance
+	}
+	if err := runner.functions.add(fn); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (runner *Executor) handleFunctionGetAll(w http.ResponseWriter, r *http.Request) {
+	functionsResp := []map[string]interface{}{}
+	for _, fn := range runner.functions.getAll() {
+		functionsResp = append(functionsResp, fn.info())
+	}
+	resp, err := json.Marshal(&functionsResp)
+	if err != nil {
+		log.Printf("Error in reading functions: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (runner *Executor) handleFunctionDelete(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	name := pathParts[len(pathParts)-1]
+	if !runner.functions.del(name) {
+		http.Error(w, "function not found", http.StatusNotFound)
+		return
+	}
+}
+
+// GetFunctionHandler gets handler for managing HTTP functions
+func (runner *Executor) GetFunctionHandler() (hCol, hRes func(w http.ResponseWriter, r *http.Request)) {
+	hCol = func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			runner.handleFunctionCreate(w, r)
+		case "GET":
+			runner.handleFunctionGetAll(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+	hRes = func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "DELETE":
+			runner.handleFunctionDelete(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+	return
+}
+
+// GetFunctionCallHandler gets handler which routes requests to HTTP functions
+func (runner *Executor) GetFunctionCallHandler() func(w http.ResponseWriter, r *http.Request) {
+	return runner.handleFunctionCall
+}
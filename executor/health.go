@@ -0,0 +1,156 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/anssihalmeaho/funl/funl"
+)
+
+func (a *app) setReady(ready bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.ready = ready
+}
+
+func (a *app) heartbeat() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.lastHeartbeat = time.Now()
+}
+
+// isStale tells whether app has not sent heartbeat within its heartbeat timeout
+func (a *app) isStale() bool {
+	timeout := a.group.spec.heartbeatTimeout
+	if timeout == 0 {
+		return false
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return time.Since(a.lastHeartbeat) > timeout
+}
+
+func (a *app) isReady() bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.ready
+}
+
+// info returns app information shown in API
+func (a *app) info() map[string]interface{} {
+	stale := a.isStale()
+	var probeInfo map[string]interface{}
+	if a.group.spec.probe != nil {
+		probeInfo = a.probeInfo()
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	appInfo := map[string]interface{}{
+		"id":              a.id,
+		"name":            a.name,
+		"replica":         a.replica,
+		"started":         a.started.Format(time.RFC3339),
+		"restarts":        a.restarts,
+		"ready":           a.ready,
+		"heartbeat-stale": stale,
+	}
+	if a.group.spec.heartbeatTimeout > 0 {
+		appInfo["last-heartbeat"] = a.lastHeartbeat.Format(time.RFC3339)
+	}
+	if probeInfo != nil {
+		appInfo["probe"] = probeInfo
+	}
+	if len(a.ports) > 0 {
+		appInfo["ports"] = a.ports
+	}
+	if a.group.spec.modules != nil {
+		appInfo["modules"] = a.group.spec.modules
+	}
+	return appInfo
+}
+
+// set-ready(<ready:bool>) -> true, ready is true if argument is not given
+func (a *app) getSetReadyProc() func(*funl.Frame, []funl.Value) funl.Value {
+	return func(frame *funl.Frame, arguments []funl.Value) funl.Value {
+		ready := true
+		if len(arguments) > 0 {
+			if arguments[0].Kind != funl.BoolValue {
+				funl.RunTimeError2(frame, "set-ready: requires bool value")
+			}
+			ready = arguments[0].Data.(bool)
+		}
+		a.setReady(ready)
+		return funl.Value{Kind: funl.BoolValue, Data: true}
+	}
+}
+
+// heartbeat() -> true
+func (a *app) getHeartbeatProc() func(*funl.Frame, []funl.Value) funl.Value {
+	return func(frame *funl.Frame, arguments []funl.Value) funl.Value {
+		a.heartbeat()
+		return funl.Value{Kind: funl.BoolValue, Data: true}
+	}
+}
+
+func (runner *Executor) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	notReady := []int{}
+	stale := []int{}
+	probeFailing := []int{}
+	apps := runner.appstore.getAll()
+	for _, appData := range apps {
+		if !appData.isReady() {
+			notReady = append(notReady, appData.id)
+		}
+		if appData.isStale() {
+			stale = append(stale, appData.id)
+		}
+		if appData.isProbeFailing() {
+			probeFailing = append(probeFailing, appData.id)
+		}
+	}
+	status := "ok"
+	statusCode := http.StatusOK
+	if len(stale) > 0 || len(probeFailing) > 0 {
+		status = "unhealthy"
+		statusCode = http.StatusServiceUnavailable
+	}
+	healthResp := map[string]interface{}{
+		"status":        status,
+		"apps":          len(apps),
+		"ready":         len(apps) - len(notReady),
+		"not-ready":     notReady,
+		"stale":         stale,
+		"probe-failing": probeFailing,
+	}
+	resp, err := json.Marshal(&healthResp)
+	if err != nil {
+		log.Printf("Error in reading health: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(resp)
+}
+
+// GetHealthHandler gets handler for aggregated health
+func (runner *Executor) GetHealthHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			runner.handleHealthz(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+}
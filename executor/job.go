@@ -0,0 +1,269 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJobWait    = 30  // seconds
+	defaultJobHistory = 100 // finished jobs kept
+)
+
+// job is one-shot run of package main procedure
+type job struct {
+	id      int
+	pack    string
+	started time.Time
+	app     *app
+
+	lock     sync.Mutex
+	finished time.Time
+	status   string
+	result   json.RawMessage
+	resText  string
+	failure  string
+	rtErr    *rtError
+}
+
+type jobStore struct {
+	m        map[int]*job
+	finished []int
+	lock     sync.RWMutex
+}
+
+func newJobStore() *jobStore {
+	return &jobStore{
+		m: map[int]*job{},
+	}
+}
+
+func (js *jobStore) add(j *job) {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+
+	js.m[j.id] = j
+}
+
+func (js *jobStore) get(id int) (*job, bool) {
+	js.lock.RLock()
+	defer js.lock.RUnlock()
+
+	j, found := js.m[id]
+	return j, found
+}
+
+// setFinished marks job finished and removes oldest finished jobs
+// so that only latest ones are kept
+func (js *jobStore) setFinished(j *job) {
+	js.lock.Lock()
+	defer js.lock.Unlock()
+
+	js.finished = append(js.finished, j.id)
+	if l := len(js.finished); l > defaultJobHistory {
+		for _, id := range js.finished[:l-defaultJobHistory] {
+			delete(js.m, id)
+		}
+		js.finished = js.finished[l-defaultJobHistory:]
+	}
+}
+
+func (j *job) info() map[string]interface{} {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	jobInfo := map[string]interface{}{
+		"id":      fmt.Sprintf("%d", j.id),
+		"pack":    j.pack,
+		"started": j.started.Format(time.RFC3339),
+		"status":  j.status,
+	}
+	if !j.finished.IsZero() {
+		jobInfo["finished"] = j.finished.Format(time.RFC3339)
+	}
+	if j.result != nil {
+		jobInfo["result"] = j.result
+	} else if j.resText != "" {
+		// result which cannot be presented as JSON is given as text
+		jobInfo["result-text"] = j.resText
+	}
+	if j.failure != "" {
+		jobInfo["error"] = j.failure
+	}
+	if j.rtErr != nil {
+		jobInfo["error-details"] = j.rtErr
+	}
+	return jobInfo
+}
+
+// waitJob waits until job app has finished and stores result
+func (runner *Executor) waitJob(j *job) {
+	<-j.app.done
+	status := j.app.outcome()
+
+	var result []byte
+	var resText string
+	if status == "succeeded" {
+		var err error
+		result, err = runner.argsEval.encodeJSON(j.app.retval)
+		if err != nil {
+			resText = fmt.Sprintf("%#v", j.app.retval)
+		}
+	}
+
+	j.lock.Lock()
+	j.finished = time.Now()
+	j.status = status
+	j.result = result
+	j.resText = resText
+	j.failure = j.app.failure
+	j.rtErr = j.app.rtErr
+	j.lock.Unlock()
+
+	runner.jobs.setFinished(j)
+}
+
+func writeJob(w http.ResponseWriter, j *job, statusCode int) {
+	resp, err := json.Marshal(j.info())
+	if err != nil {
+		log.Printf("Error in reading job: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(resp)
+}
+
+func (runner *Executor) handleJobCreate(w http.ResponseWriter, r *http.Request) {
+	type jobRequest struct {
+		Pack           string          `json:"pack"`
+		Args           json.RawMessage `json:"args"`
+		HaveCTXasLast  bool            `json:"ctx-last"`
+		HaveCTXasFirst bool            `json:"ctx-1st"`
+		Wait           *int            `json:"wait"`
+		Modules        []string        `json:"modules"`
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req jobRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wait := defaultJobWait
+	if req.Wait != nil {
+		wait = *req.Wait
+	}
+	if wait < 0 {
+		http.Error(w, "wait should not be negative", http.StatusBadRequest)
+		return
+	}
+
+	code, packFound := runner.getPack(req.Pack)
+	if !packFound {
+		http.Error(w, "package not found", http.StatusNotFound)
+		return
+	}
+	if err := checkModuleNames(req.Modules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	modules, err := runner.allowedModules(code, req.Modules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := validatePack(req.Pack, code, modules); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	args, status, err := runner.makeArgs(code, req.Args)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	grp := &appGroup{
+		name: req.Pack,
+		kind: groupJob,
+		spec: &appSpec{
+			pack:           req.Pack,
+			code:           code,
+			args:           args,
+			haveCTXasFirst: req.HaveCTXasFirst,
+			haveCTXasLast:  req.HaveCTXasLast,
+			restartPolicy:  restartNever,
+			modules:        modules,
+		},
+		replicas: 1,
+	}
+	appInstance := runner.startApp(grp, 0, 1, 0)
+	j := &job{
+		id:      appInstance.id,
+		pack:    req.Pack,
+		started: appInstance.started,
+		app:     appInstance,
+		status:  "running",
+	}
+	runner.jobs.add(j)
+	finished := make(chan struct{})
+	go func() {
+		runner.waitJob(j)
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		writeJob(w, j, http.StatusOK)
+	case <-time.After(time.Duration(wait) * time.Second):
+		writeJob(w, j, http.StatusAccepted)
+	}
+}
+
+func (runner *Executor) handleJobGet(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	jobID, err := strconv.Atoi(pathParts[len(pathParts)-1])
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	j, found := runner.jobs.get(jobID)
+	if !found {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	writeJob(w, j, http.StatusOK)
+}
+
+// GetJobHandler gets handler for one-shot jobs
+func (runner *Executor) GetJobHandler() (hCol, hRes func(w http.ResponseWriter, r *http.Request)) {
+	hCol = func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			runner.handleJobCreate(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+	hRes = func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			runner.handleJobGet(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/anssihalmeaho/funl/funl"
+)
+
+const manifestFile = "manifest.json"
+
+// packManifest is optional manifest.json file in package, it describes
+// main procedure parameters and builtin modules which package may import
+type packManifest struct {
+	Params     []string    `json:"params"`
+	ArgsSchema *jsonSchema `json:"args-schema"`
+	ArgsTypes  []string    `json:"args-types"`
+	Modules    []string    `json:"modules"`
+}
+
+// readManifest reads manifest from package, nil is returned
+// if package has no manifest
+func readManifest(code []byte) (*packManifest, error) {
+	tr := tar.NewReader(bytes.NewReader(code))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, file := filepath.Split(hdr.Name); file != manifestFile || hdr.FileInfo().IsDir() {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		var manifest packManifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid package manifest: %v", err)
+		}
+		return &manifest, nil
+	}
+}
+
+// namedToPositional maps named arguments onto positions
+// by parameter names
+func namedToPositional(params []string, named map[string]json.RawMessage) ([]byte, error) {
+	known := map[string]bool{}
+	for _, param := range params {
+		known[param] = true
+	}
+	for name := range named {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown parameter: %s", name)
+		}
+	}
+	positional := []json.RawMessage{}
+	for _, param := range params {
+		value, found := named[param]
+		if !found {
+			return nil, fmt.Errorf("missing parameter: %s", param)
+		}
+		positional = append(positional, value)
+	}
+	return json.Marshal(positional)
+}
+
+// makeArgs makes arguments of main procedure from JSON array (positional arguments)
+// or JSON object (named arguments), arguments are validated if package manifest
+// declares schema or types for those, in case of error also status code is returned
+func (runner *Executor) makeArgs(code []byte, jsonArgs []byte) (args []*funl.Item, status int, err error) {
+	manifest, err := readManifest(code)
+	if err != nil {
+		return nil, http.StatusUnprocessableEntity, err
+	}
+	if manifest == nil {
+		manifest = &packManifest{}
+	}
+
+	trimmed := bytes.TrimSpace(jsonArgs)
+	if manifest.ArgsSchema != nil && len(trimmed) > 0 {
+		value, err := decodeJSONValue(trimmed)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid request")
+		}
+		if err := manifest.ArgsSchema.validate(value, "args"); err != nil {
+			return nil, http.StatusUnprocessableEntity, err
+		}
+	}
+
+	positional := jsonArgs
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		if manifest.Params == nil {
+			// object is given as one map parameter
+			positional = append(append([]byte("["), trimmed...), ']')
+		} else {
+			var named map[string]json.RawMessage
+			if err := json.Unmarshal(trimmed, &named); err != nil {
+				return nil, http.StatusBadRequest, fmt.Errorf("invalid request")
+			}
+			if positional, err = namedToPositional(manifest.Params, named); err != nil {
+				return nil, http.StatusUnprocessableEntity, err
+			}
+		}
+	}
+
+	if manifest.ArgsTypes != nil && len(trimmed) > 0 {
+		if err := validateArgTypes(manifest.ArgsTypes, positional); err != nil {
+			return nil, http.StatusUnprocessableEntity, err
+		}
+	}
+	args, err = runner.decodeArgs(positional)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return args, http.StatusOK, nil
+}
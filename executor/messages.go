@@ -0,0 +1,276 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/anssihalmeaho/funl/funl"
+)
+
+const inboxSize = 100
+
+// get returns running app instance by id
+func (aps *appStore) get(appID int) (*app, bool) {
+	aps.lock.RLock()
+	defer aps.lock.RUnlock()
+
+	appInstance, found := aps.m[appID]
+	return appInstance, found
+}
+
+// getByName returns running app instances which have given name
+func (aps *appStore) getByName(name string) []*app {
+	apps := []*app{}
+	for _, appInstance := range aps.getAll() {
+		if appInstance.name == name {
+			apps = append(apps, appInstance)
+		}
+	}
+	return apps
+}
+
+// makeMessage makes message envelope, sender is empty (and id zero) for external messages
+func (runner *Executor) makeMessage(sender *app, body funl.Value) funl.Value {
+	from, fromID := "", 0
+	if sender != nil {
+		from, fromID = sender.name, sender.id
+	}
+	return makeMap(runner.argsEval.frame, map[string]funl.Value{
+		"from":    {Kind: funl.StringValue, Data: from},
+		"from-id": {Kind: funl.IntValue, Data: fromID},
+		"body":    body,
+	})
+}
+
+// deliver puts message to inbox of app, it's not waited
+// if inbox is full (false is returned)
+func deliver(target *app, msg funl.Value) bool {
+	select {
+	case target.inbox <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// findTargets returns app instances addressed by id (int) or name (string)
+func (runner *Executor) findTargets(target funl.Value) ([]*app, error) {
+	switch target.Kind {
+	case funl.IntValue:
+		appInstance, found := runner.appstore.get(target.Data.(int))
+		if !found {
+			return nil, fmt.Errorf("app not found: %d", target.Data.(int))
+		}
+		return []*app{appInstance}, nil
+	case funl.StringValue:
+		apps := runner.appstore.getByName(target.Data.(string))
+		if len(apps) == 0 {
+			return nil, fmt.Errorf("app not found: %s", target.Data.(string))
+		}
+		return apps, nil
+	}
+	return nil, fmt.Errorf("app id (int) or name (string) assumed")
+}
+
+// getSendProc returns procedure for sending message to other app(s):
+// send(<target:int/string> <message>) -> list(<ok:bool> <error:string>)
+func (runner *Executor) getSendProc(sender *app) func(*funl.Frame, []funl.Value) funl.Value {
+	return func(frame *funl.Frame, arguments []funl.Value) funl.Value {
+		if l := len(arguments); l != 2 {
+			funl.RunTimeError2(frame, "send: wrong amount of arguments (%d), need two", l)
+		}
+		result := func(err error) funl.Value {
+			errText := ""
+			if err != nil {
+				errText = err.Error()
+			}
+			return funl.MakeListOfValues(frame, []funl.Value{
+				{Kind: funl.BoolValue, Data: err == nil},
+				{Kind: funl.StringValue, Data: errText},
+			})
+		}
+
+		targets, err := runner.findTargets(arguments[0])
+		if err != nil {
+			return result(err)
+		}
+		msg := runner.makeMessage(sender, arguments[1])
+		for _, target := range targets {
+			if !deliver(target, msg) {
+				err = fmt.Errorf("inbox full: %d (%s)", target.id, target.name)
+			}
+		}
+		return result(err)
+	}
+}
+
+func (runner *Executor) handleAppMessage(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(strings.TrimSuffix(r.URL.Path, "/messages"), "/")
+	appIDNum, err := strconv.Atoi(pathParts[len(pathParts)-1])
+	if err != nil {
+		http.Error(w, "invalid app id", http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	msgBody, err := runner.argsEval.decodeJSON(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid message: %v", err), http.StatusBadRequest)
+		return
+	}
+	target, found := runner.appstore.get(appIDNum)
+	if !found {
+		http.Error(w, "app not found", http.StatusNotFound)
+		return
+	}
+	if !deliver(target, runner.makeMessage(nil, msgBody)) {
+		http.Error(w, "inbox full", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+const (
+	defaultCallTimeout = 10 // seconds
+	maxServerCalls     = 16
+)
+
+// getServeProc returns procedure with which app registers handler
+// for requests from other apps: serve(<handler:proc>) -> true
+func (a *app) getServeProc() func(*funl.Frame, []funl.Value) funl.Value {
+	return func(frame *funl.Frame, arguments []funl.Value) funl.Value {
+		if l := len(arguments); l != 1 {
+			funl.RunTimeError2(frame, "serve: wrong amount of arguments (%d), need one", l)
+		}
+		if k := arguments[0].Kind; k != funl.FunctionValue && k != funl.ExtProcValue {
+			funl.RunTimeError2(frame, "serve: requires function or procedure value")
+		}
+		handlerFrame := funl.NewTopFrameWithInterpreter(frame.GetTopFrame().Interpreter)
+		handlerFrame.SetInProcCall(true)
+
+		a.lock.Lock()
+		defer a.lock.Unlock()
+
+		a.handler = arguments[0]
+		a.handlerFrame = handlerFrame
+		return funl.Value{Kind: funl.BoolValue, Data: true}
+	}
+}
+
+// findServer returns one of app instances (in turns) addressed by
+// id or name which have registered request handler
+func (runner *Executor) findServer(target funl.Value) (*app, error) {
+	targets, err := runner.findTargets(target)
+	if err != nil {
+		return nil, err
+	}
+	servers := []*app{}
+	for _, appInstance := range targets {
+		appInstance.lock.Lock()
+		serving := appInstance.handlerFrame != nil
+		appInstance.lock.Unlock()
+		if serving {
+			servers = append(servers, appInstance)
+		}
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("app does not serve requests: %v", target.Data)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].id < servers[j].id })
+	turn := atomic.AddUint64(&runner.callCount, 1)
+	return servers[turn%uint64(len(servers))], nil
+}
+
+// callHandler calls request handler of app, runtime error in handler is returned as error
+func callHandler(server *app, request funl.Value) (response funl.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	server.lock.Lock()
+	handler, frame := server.handler, server.handlerFrame
+	server.lock.Unlock()
+
+	operands := []*funl.Item{
+		&funl.Item{Type: funl.ValueItem, Data: handler},
+		&funl.Item{Type: funl.ValueItem, Data: request},
+	}
+	return funl.HandleCallOP(frame, operands), nil
+}
+
+// getCallAppProc returns procedure for calling other app and waiting its response:
+// call-app(<target:int/string> <request> [<timeout:int/float>]) -> list(<ok:bool> <error:string> <response>)
+func (runner *Executor) getCallAppProc(caller *app) func(*funl.Frame, []funl.Value) funl.Value {
+	return func(frame *funl.Frame, arguments []funl.Value) funl.Value {
+		if l := len(arguments); l != 2 && l != 3 {
+			funl.RunTimeError2(frame, "call-app: wrong amount of arguments (%d), need two or three", l)
+		}
+		timeout := defaultCallTimeout * time.Second
+		if len(arguments) == 3 {
+			switch timeoutv := arguments[2]; timeoutv.Kind {
+			case funl.IntValue:
+				timeout = time.Duration(timeoutv.Data.(int)) * time.Second
+			case funl.FloatValue:
+				timeout = time.Duration(timeoutv.Data.(float64) * float64(time.Second))
+			default:
+				funl.RunTimeError2(frame, "call-app: requires int or float value as timeout")
+			}
+		}
+		result := func(err error, response funl.Value) funl.Value {
+			errText := ""
+			if err != nil {
+				errText = err.Error()
+				response = funl.Value{Kind: funl.StringValue, Data: ""}
+			}
+			return funl.MakeListOfValues(frame, []funl.Value{
+				{Kind: funl.BoolValue, Data: err == nil},
+				{Kind: funl.StringValue, Data: errText},
+				response,
+			})
+		}
+
+		server, err := runner.findServer(arguments[0])
+		if err != nil {
+			return result(err, funl.Value{})
+		}
+		type callResult struct {
+			response funl.Value
+			err      error
+		}
+		timeoutErr := fmt.Errorf("timeout in calling app: %d (%s)", server.id, server.name)
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		// handler calls in progress are bounded per server (also the ones
+		// which are still running after caller got timeout)
+		select {
+		case server.calls <- struct{}{}:
+		case <-timer.C:
+			return result(timeoutErr, funl.Value{})
+		}
+		resultCh := make(chan callResult, 1)
+		request := runner.makeMessage(caller, arguments[1])
+		go func() {
+			defer func() { <-server.calls }()
+			response, err := callHandler(server, request)
+			resultCh <- callResult{response: response, err: err}
+		}()
+		select {
+		case res := <-resultCh:
+			return result(res.err, res.response)
+		case <-timer.C:
+			return result(timeoutErr, funl.Value{})
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/anssihalmeaho/funl/funl"
+	"github.com/anssihalmeaho/funl/std"
+)
+
+// allow-lists of builtin modules (std-lib and extensions) by
+// interpreter of app, set before interpreter is initialized
+var (
+	moduleAllowLists     = map[*funl.Interpreter]map[string]bool{}
+	moduleAllowListsLock sync.Mutex
+)
+
+var (
+	builtinNamesOnce sync.Once
+	builtinNames     []string
+)
+
+func init() {
+	// executor imports extensions so this is called after extension initializers
+	funl.AddExtensionInitializer(applyModuleAllowList)
+}
+
+// builtinModuleNames returns names of all builtin modules
+func builtinModuleNames() []string {
+	builtinNamesOnce.Do(func() {
+		nsDir := builtinModules().NsDir
+		for sid := 1; sid < funl.SymIDMap.SymbolCount(); sid++ {
+			if !nsDir.HasNS(funl.SymID(sid)) {
+				continue
+			}
+			if name := funl.SymIDMap.AsString(funl.SymID(sid)); name != "main" {
+				builtinNames = append(builtinNames, name)
+			}
+		}
+		sort.Strings(builtinNames)
+	})
+	return builtinNames
+}
+
+// checkModuleNames returns error if some name is not builtin module
+func checkModuleNames(names []string) error {
+	for _, name := range names {
+		if !isBuiltinModule(name) || name == "main" {
+			return fmt.Errorf("unknown module in allow-list: %s", name)
+		}
+	}
+	return nil
+}
+
+// SetModuleAllowList sets comma separated list of builtin modules which apps
+// may import by default (package manifest and request can only narrow it)
+func (runner *Executor) SetModuleAllowList(allowList string) error {
+	modules := []string{}
+	for _, name := range strings.Split(allowList, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			modules = append(modules, name)
+		}
+	}
+	if err := checkModuleNames(modules); err != nil {
+		return err
+	}
+	runner.modules = modules
+	return nil
+}
+
+// allowedModules returns allow-list of builtin modules for app from default
+// allow-list, package manifest and request, only modules which are in all
+// given lists are allowed (nil means that all modules are allowed)
+func (runner *Executor) allowedModules(code []byte, requested []string) ([]string, error) {
+	manifest, err := readManifest(code)
+	if err != nil {
+		return nil, err
+	}
+	allowed := runner.modules
+	if manifest != nil && manifest.Modules != nil {
+		if err := checkModuleNames(manifest.Modules); err != nil {
+			return nil, fmt.Errorf("package manifest: %v", err)
+		}
+		allowed = narrowModules(allowed, manifest.Modules)
+	}
+	return narrowModules(allowed, requested), nil
+}
+
+// narrowModules returns modules which are in both allow-lists (nil allows all)
+func narrowModules(allowed, narrowing []string) []string {
+	if narrowing == nil {
+		return allowed
+	}
+	if allowed == nil {
+		return narrowing
+	}
+	inNarrowing := map[string]bool{}
+	for _, name := range narrowing {
+		inNarrowing[name] = true
+	}
+	narrowed := []string{}
+	for _, name := range allowed {
+		if inNarrowing[name] {
+			narrowed = append(narrowed, name)
+		}
+	}
+	return narrowed
+}
+
+// isModuleAllowed tells whether builtin module is in allow-list (nil allows all)
+func isModuleAllowed(name string, allowed []string) bool {
+	if allowed == nil {
+		return true
+	}
+	for _, allowedName := range allowed {
+		if allowedName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getInitSTD returns std-lib initializer which sets module allow-list
+// (if given) for interpreter before other initialization
+func getInitSTD(modules []string) func(*funl.Interpreter) error {
+	return func(interpreter *funl.Interpreter) error {
+		if modules != nil {
+			allowed := map[string]bool{}
+			for _, name := range modules {
+				allowed[name] = true
+			}
+			moduleAllowListsLock.Lock()
+			moduleAllowLists[interpreter] = allowed
+			moduleAllowListsLock.Unlock()
+		}
+		return std.InitSTD(interpreter)
+	}
+}
+
+// clearModuleAllowList removes allow-list of interpreter (if not applied)
+func clearModuleAllowList(interpreter *funl.Interpreter) {
+	moduleAllowListsLock.Lock()
+	defer moduleAllowListsLock.Unlock()
+
+	delete(moduleAllowLists, interpreter)
+}
+
+// allowListImporter refuses builtin modules which are not allowed,
+// other modules are imported with original importer
+type allowListImporter struct {
+	importer funl.ModuleImporter
+	refused  map[string]bool
+}
+
+func (ali *allowListImporter) FindModule(importFileName string, extensionName string) (string, []byte, error) {
+	if ali.refused[importFileName] {
+		return (&refusingImporter{}).FindModule(importFileName, extensionName)
+	}
+	return ali.importer.FindModule(importFileName, extensionName)
+}
+
+// applyModuleAllowList is extension initializer which leaves only allowed
+// builtin modules to interpreter, importing other builtin modules fails
+// (also when imported inside procedures or in eval)
+func applyModuleAllowList(interpreter *funl.Interpreter) error {
+	moduleAllowListsLock.Lock()
+	allowed, found := moduleAllowLists[interpreter]
+	delete(moduleAllowLists, interpreter)
+	moduleAllowListsLock.Unlock()
+
+	if !found {
+		return nil
+	}
+	nsDir := funl.NewInterpreter().NsDir
+	refused := map[string]bool{}
+	for _, name := range builtinModuleNames() {
+		sid, _ := funl.SymIDMap.Get(name)
+		frame, found := interpreter.NsDir.GetTopFrameBySID(sid)
+		switch {
+		case !found:
+		case allowed[name]:
+			nsDir.Put(sid, frame)
+		default:
+			refused[name] = true
+		}
+	}
+	interpreter.NsDir = nsDir
+	interpreter.Importer = &allowListImporter{importer: interpreter.Importer, refused: refused}
+	return nil
+}
@@ -0,0 +1,30 @@
+package executor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNarrowModules(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowed   []string
+		narrowing []string
+		expected  []string
+	}{
+		{"all allowed", nil, nil, nil},
+		{"default only", []string{"stdstr", "stdmath"}, nil, []string{"stdstr", "stdmath"}},
+		{"narrowing only", nil, []string{"stdjson"}, []string{"stdjson"}},
+		{"narrowed", []string{"stdstr", "stdmath"}, []string{"stdmath", "stdos"}, []string{"stdmath"}},
+		{"not widened", []string{"stdstr"}, []string{"stdos"}, []string{}},
+		{"empty narrowing", []string{"stdstr"}, []string{}, []string{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			narrowed := narrowModules(tc.allowed, tc.narrowing)
+			if !reflect.DeepEqual(narrowed, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, narrowed)
+			}
+		})
+	}
+}
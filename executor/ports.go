@@ -0,0 +1,122 @@
+package executor
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// portPool contains ports which executor allocates for apps
+type portPool struct {
+	first int
+	last  int
+	used  map[int]int // port -> app id
+	lock  sync.Mutex
+}
+
+func newPortPool() *portPool {
+	return &portPool{
+		used: map[int]int{},
+	}
+}
+
+// isFree tells whether port can be listened (it's not used outside of executor)
+func isFree(port int) bool {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return false
+	}
+	l.Close()
+	return true
+}
+
+func (pp *portPool) setRange(first, last int) {
+	pp.lock.Lock()
+	defer pp.lock.Unlock()
+
+	pp.first = first
+	pp.last = last
+}
+
+// free returns number of ports not allocated
+func (pp *portPool) free() int {
+	pp.lock.Lock()
+	defer pp.lock.Unlock()
+
+	if pp.first == 0 {
+		return 0
+	}
+	return pp.last - pp.first + 1 - len(pp.used)
+}
+
+// alloc allocates given amount of ports for app
+func (pp *portPool) alloc(count int, appID int) ([]int, error) {
+	pp.lock.Lock()
+	defer pp.lock.Unlock()
+
+	if pp.first == 0 {
+		return nil, fmt.Errorf("port range not configured")
+	}
+	ports := []int{}
+	for port := pp.first; port <= pp.last && len(ports) < count; port++ {
+		if _, found := pp.used[port]; found || !isFree(port) {
+			continue
+		}
+		ports = append(ports, port)
+	}
+	if len(ports) < count {
+		return nil, fmt.Errorf("not enough free ports (%d assumed)", count)
+	}
+	for _, port := range ports {
+		pp.used[port] = appID
+	}
+	return ports, nil
+}
+
+func (pp *portPool) release(ports []int) {
+	pp.lock.Lock()
+	defer pp.lock.Unlock()
+
+	for _, port := range ports {
+		delete(pp.used, port)
+	}
+}
+
+// parsePortRange parses range like "20000-20999"
+func parsePortRange(portRange string) (first, last int, err error) {
+	parts := strings.Split(portRange, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("port range should be <first>-<last>: %s", portRange)
+	}
+	if first, err = strconv.Atoi(strings.TrimSpace(parts[0])); err != nil {
+		return 0, 0, fmt.Errorf("invalid port range: %s", portRange)
+	}
+	if last, err = strconv.Atoi(strings.TrimSpace(parts[1])); err != nil {
+		return 0, 0, fmt.Errorf("invalid port range: %s", portRange)
+	}
+	if first <= 0 || last > 65535 || first > last {
+		return 0, 0, fmt.Errorf("invalid port range: %s", portRange)
+	}
+	return first, last, nil
+}
+
+// targetPort returns port to which executor connects app instance, if port is
+// not given first allocated port is used, otherwise replica index is added to port
+func (a *app) targetPort(port int) int {
+	if port == 0 && len(a.ports) > 0 {
+		return a.ports[0]
+	}
+	return appPort(port, a)
+}
+
+// SetPortRange sets range of ports (like "20000-20999") allocated for apps
+func (runner *Executor) SetPortRange(portRange string) error {
+	first, last, err := parsePortRange(portRange)
+	if err != nil {
+		return err
+	}
+	runner.ports.setRange(first, last)
+	return nil
+}
@@ -0,0 +1,141 @@
+package executor
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultProbeInterval         = 10 // seconds
+	defaultProbeTimeout          = 1  // seconds
+	defaultProbeFailureThreshold = 3
+)
+
+// httpProbe is HTTP health probe which executor polls for app
+type httpProbe struct {
+	Path             string `json:"path"`
+	Port             int    `json:"port"`
+	Interval         int    `json:"interval"`
+	Timeout          int    `json:"timeout"`
+	FailureThreshold int    `json:"failure-threshold"`
+}
+
+// probeState contains results of probing
+type probeState struct {
+	lastProbe   time.Time
+	lastOK      bool
+	lastError   string
+	failures    int
+	totalFailed int
+}
+
+// validate checks probe and sets defaults, port may be omitted
+// if ports are allocated for app
+func (probe *httpProbe) validate(hasPorts bool) error {
+	if probe.Port < 0 || (probe.Port == 0 && !hasPorts) {
+		return fmt.Errorf("probe port assumed")
+	}
+	if probe.Interval < 0 || probe.Timeout < 0 || probe.FailureThreshold < 0 {
+		return fmt.Errorf("probe values should not be negative")
+	}
+	if probe.Path == "" {
+		probe.Path = "/"
+	}
+	if probe.Interval == 0 {
+		probe.Interval = defaultProbeInterval
+	}
+	if probe.Timeout == 0 {
+		probe.Timeout = defaultProbeTimeout
+	}
+	if probe.FailureThreshold == 0 {
+		probe.FailureThreshold = defaultProbeFailureThreshold
+	}
+	return nil
+}
+
+// appPort returns port of app instance, replica uses port
+// which is given port added with replica index
+func appPort(port int, a *app) int {
+	return port + a.replica
+}
+
+func (a *app) recordProbe(err error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.probe.lastProbe = time.Now()
+	a.probe.lastOK = (err == nil)
+	if err != nil {
+		a.probe.lastError = err.Error()
+		a.probe.failures++
+		a.probe.totalFailed++
+		return
+	}
+	a.probe.lastError = ""
+	a.probe.failures = 0
+}
+
+// isProbeFailing tells whether probe has failed at least failure threshold times in a row
+func (a *app) isProbeFailing() bool {
+	probe := a.group.spec.probe
+	if probe == nil {
+		return false
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.probe.failures >= probe.FailureThreshold
+}
+
+func (a *app) probeInfo() map[string]interface{} {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	probeInfo := map[string]interface{}{
+		"ok":           a.probe.lastOK,
+		"failures":     a.probe.failures,
+		"total-failed": a.probe.totalFailed,
+		"error":        a.probe.lastError,
+	}
+	if !a.probe.lastProbe.IsZero() {
+		probeInfo["last-probe"] = a.probe.lastProbe.Format(time.RFC3339)
+	}
+	return probeInfo
+}
+
+func doProbe(client *http.Client, url string) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("probe status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// runProbe polls HTTP probe of app until app exits,
+// app is restarted (according to restart policy) when failure threshold is reached
+func (runner *Executor) runProbe(a *app) {
+	probe := a.group.spec.probe
+	client := &http.Client{Timeout: time.Duration(probe.Timeout) * time.Second}
+	url := fmt.Sprintf("http://localhost:%d%s", a.targetPort(probe.Port), probe.Path)
+
+	ticker := time.NewTicker(time.Duration(probe.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+		}
+		a.recordProbe(doProbe(client, url))
+		// restart policy other than never is accepted only for apps with context
+		if a.isProbeFailing() && a.group.spec.restartPolicy != restartNever {
+			runner.restartApp(a, "probe failed")
+		}
+	}
+}
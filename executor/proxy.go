@@ -0,0 +1,244 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// appRoute tells which requests apprunner proxies to app
+type appRoute struct {
+	Prefix      string `json:"prefix"`
+	Host        string `json:"host"`
+	Port        int    `json:"port"`
+	StripPrefix bool   `json:"strip-prefix"`
+}
+
+// reservedPrefixes are paths served by apprunner itself (see main.go),
+// requests to those are never proxied
+var reservedPrefixes = []string{
+	"/packs", "/app", "/app-groups", "/app-exits", "/app-data", "/healthz",
+	"/schedules", "/jobs", "/functions", "/fn", "/routes", "/configs",
+	"/secrets", "/appval", "/topics",
+}
+
+// routeStats contains proxy statistics of route
+type routeStats struct {
+	lock        sync.Mutex
+	next        int
+	requests    int
+	failed      int
+	unavailable int
+	perReplica  map[int]int
+}
+
+// validate checks route, port may be omitted if ports are allocated for app
+func (route *appRoute) validate(hasPorts bool) error {
+	if route.Prefix == "" && route.Host == "" {
+		return fmt.Errorf("route prefix or host assumed")
+	}
+	if route.Prefix != "" && !strings.HasPrefix(route.Prefix, "/") {
+		return fmt.Errorf("route prefix should start with /")
+	}
+	if route.Port < 0 || (route.Port == 0 && !hasPorts) {
+		return fmt.Errorf("route port assumed")
+	}
+	route.Prefix = strings.TrimSuffix(route.Prefix, "/")
+	for _, reserved := range reservedPrefixes {
+		if route.Prefix == reserved || strings.HasPrefix(route.Prefix, reserved+"/") {
+			return fmt.Errorf("route prefix is reserved by apprunner: %s", reserved)
+		}
+	}
+	return nil
+}
+
+// matches tells whether request is for route, returned length tells
+// how specific match is (longer is better)
+func (route *appRoute) matches(host, path string) (bool, int) {
+	if route.Host != "" && route.Host != host {
+		return false, 0
+	}
+	if route.Prefix != "" && path != route.Prefix && !strings.HasPrefix(path, route.Prefix+"/") {
+		return false, 0
+	}
+	return true, len(route.Host) + len(route.Prefix)
+}
+
+func newRouteStats() *routeStats {
+	return &routeStats{
+		perReplica: map[int]int{},
+	}
+}
+
+func (stats *routeStats) info() map[string]interface{} {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+
+	perReplica := map[string]int{}
+	for replica, count := range stats.perReplica {
+		perReplica[fmt.Sprintf("%d", replica)] = count
+	}
+	return map[string]interface{}{
+		"requests":    stats.requests,
+		"failed":      stats.failed,
+		"unavailable": stats.unavailable,
+		"per-replica": perReplica,
+	}
+}
+
+// pick selects next app instance in round-robin manner
+func (stats *routeStats) pick(apps []*app) *app {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+
+	stats.requests++
+	if len(apps) == 0 {
+		stats.unavailable++
+		return nil
+	}
+	selected := apps[stats.next%len(apps)]
+	stats.next++
+	stats.perReplica[selected.replica]++
+	return selected
+}
+
+func (stats *routeStats) addFailed() {
+	stats.lock.Lock()
+	defer stats.lock.Unlock()
+
+	stats.failed++
+}
+
+// hasRouteConflict tells whether some other group has same route,
+// assumed to be called with lock held
+func (aps *appStore) hasRouteConflict(grp *appGroup) bool {
+	route := grp.spec.route
+	if route == nil {
+		return false
+	}
+	for other := range aps.groups {
+		otherRoute := other.spec.route
+		if otherRoute != nil && otherRoute.Host == route.Host && otherRoute.Prefix == route.Prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// findRoute returns group which has best matching route for request
+func (aps *appStore) findRoute(host, path string) *appGroup {
+	aps.lock.RLock()
+	defer aps.lock.RUnlock()
+
+	var selected *appGroup
+	bestLen := -1
+	for grp := range aps.groups {
+		if grp.spec.route == nil {
+			continue
+		}
+		if ok, matchLen := grp.spec.route.matches(host, path); ok && matchLen > bestLen {
+			selected = grp
+			bestLen = matchLen
+		}
+	}
+	return selected
+}
+
+// readyApps returns instances of group which can receive requests
+func (runner *Executor) readyApps(grp *appGroup) []*app {
+	apps := []*app{}
+	for _, appData := range runner.appstore.getGroupApps(grp) {
+		if appData.isReady() && !appData.isStale() && !appData.isProbeFailing() {
+			apps = append(apps, appData)
+		}
+	}
+	// keep order stable for round-robin
+	sort.Slice(apps, func(i, j int) bool { return apps[i].replica < apps[j].replica })
+	return apps
+}
+
+func (runner *Executor) handleProxy(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	grp := runner.appstore.findRoute(host, r.URL.Path)
+	if grp == nil {
+		http.NotFound(w, r)
+		return
+	}
+	route := grp.spec.route
+	target := grp.stats.pick(runner.readyApps(grp))
+	if target == nil {
+		http.Error(w, "no ready app for route", http.StatusServiceUnavailable)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = fmt.Sprintf("localhost:%d", target.targetPort(route.Port))
+			if route.StripPrefix {
+				req.URL.Path = strings.TrimPrefix(req.URL.Path, route.Prefix)
+				if req.URL.Path == "" {
+					req.URL.Path = "/"
+				}
+				req.URL.RawPath = ""
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			grp.stats.addFailed()
+			log.Printf("Proxy error for app %d (%s): %v", target.id, target.name, err)
+			http.Error(w, "app not responding", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+func (runner *Executor) handleRouteGetAll(w http.ResponseWriter, r *http.Request) {
+	routesResp := []map[string]interface{}{}
+	for _, grp := range runner.appstore.getGroups() {
+		route := grp.spec.route
+		if route == nil {
+			continue
+		}
+		routeInfo := grp.stats.info()
+		routeInfo["name"] = grp.name
+		routeInfo["prefix"] = route.Prefix
+		routeInfo["host"] = route.Host
+		routeInfo["port"] = route.Port
+		routeInfo["ready"] = len(runner.readyApps(grp))
+		routesResp = append(routesResp, routeInfo)
+	}
+	resp, err := json.Marshal(&routesResp)
+	if err != nil {
+		log.Printf("Error in reading routes: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// GetProxyHandler gets handler which proxies requests to apps by their routes
+func (runner *Executor) GetProxyHandler() func(w http.ResponseWriter, r *http.Request) {
+	return runner.handleProxy
+}
+
+// GetRouteHandler gets handler for reading routes
+func (runner *Executor) GetRouteHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			runner.handleRouteGetAll(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package executor
+
+import "testing"
+
+func TestRouteValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    appRoute
+		hasPorts bool
+		ok       bool
+	}{
+		{"prefix", appRoute{Prefix: "/myapp", Port: 8000}, false, true},
+		{"host", appRoute{Host: "example.com", Port: 8000}, false, true},
+		{"allocated port", appRoute{Prefix: "/myapp"}, true, true},
+		{"similar to reserved", appRoute{Prefix: "/apps", Port: 8000}, false, true},
+		{"no prefix or host", appRoute{Port: 8000}, false, false},
+		{"relative prefix", appRoute{Prefix: "myapp", Port: 8000}, false, false},
+		{"no port", appRoute{Prefix: "/myapp"}, false, false},
+		{"reserved", appRoute{Prefix: "/app", Port: 8000}, false, false},
+		{"reserved with slash", appRoute{Prefix: "/packs/", Port: 8000}, false, false},
+		{"under reserved", appRoute{Prefix: "/fn/myfn", Port: 8000}, false, false},
+		{"reserved with host", appRoute{Prefix: "/topics", Host: "example.com", Port: 8000}, false, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.route.validate(tc.hasPorts)
+			if tc.ok && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
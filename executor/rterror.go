@@ -0,0 +1,19 @@
+package executor
+
+import (
+	"fmt"
+)
+
+// rtError is FunL runtime error in structured form, interpreter gives runtime
+// error only as error value (call scope is just printed to output) so
+// location and call chain are not available
+type rtError struct {
+	Message string `json:"message"`
+}
+
+// newRTError makes structured runtime error from recovered value
+func newRTError(r interface{}) *rtError {
+	return &rtError{
+		Message: fmt.Sprintf("%v", r),
+	}
+}
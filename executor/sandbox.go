@@ -0,0 +1,139 @@
+package executor
+
+import (
+	"fmt"
+	"time"
+
+	"apprunner/extensions"
+
+	"github.com/anssihalmeaho/funl/funl"
+	"github.com/anssihalmeaho/funl/std"
+)
+
+const (
+	sandboxEvalTimeout = 2 // seconds
+	maxSandboxEvals    = 4 // evaluations running at same time
+)
+
+// modules which have no side-effects and can be used in sandbox
+var sandboxModules = []string{
+	"stdstr",
+	"stdmath",
+	"stdbytes",
+	"stdjson",
+	"stdbase64",
+	"stddbc",
+	"stdfu",
+	"stdmeta",
+	"stdser",
+	"stdset",
+	"stdsort",
+}
+
+// refusingImporter gives module which causes runtime error
+// for any module which is not in sandbox
+type refusingImporter struct{}
+
+func (ri *refusingImporter) FindModule(importFileName string, extensionName string) (string, []byte, error) {
+	content := fmt.Sprintf("ns %s\n\nrefused = error('module not allowed: %s')\n\nendns\n", importFileName, importFileName)
+	return importFileName, []byte(content), nil
+}
+
+// sandbox evaluates FunL expressions with only
+// side-effect free std modules available
+type sandbox struct {
+	interpreter *funl.Interpreter
+	slots       chan struct{}
+}
+
+func newSandbox() *sandbox {
+	full := funl.NewInterpreter()
+	if err := std.InitSTD(full); err != nil {
+		panic(fmt.Errorf("Error in std-lib init (%v)", err))
+	}
+	if err := funl.InitFunSourceSTD(full); err != nil {
+		panic(fmt.Errorf("Error in std-lib (fun source) init (%v)", err))
+	}
+
+	interpreter := funl.NewInterpreter()
+	interpreter.Importer = &refusingImporter{}
+	for _, modName := range sandboxModules {
+		sid, found := funl.SymIDMap.Get(modName)
+		if !found {
+			panic(fmt.Errorf("Sandbox module not found: %s", modName))
+		}
+		frame, found := full.NsDir.GetTopFrameBySID(sid)
+		if !found {
+			panic(fmt.Errorf("Sandbox module not found: %s", modName))
+		}
+		interpreter.NsDir.Put(sid, frame)
+	}
+	return &sandbox{
+		interpreter: interpreter,
+		slots:       make(chan struct{}, maxSandboxEvals),
+	}
+}
+
+// eval evaluates expression, evaluation which does not finish within
+// timeout is abandoned. Abandoned evaluation can't be killed so it keeps
+// running (and reserving its slot), if all slots are reserved evaluation
+// is refused with extensions.ErrEvalBusy
+func (sb *sandbox) eval(source string) (funl.Value, error) {
+	type evalResult struct {
+		value funl.Value
+		err   error
+	}
+	select {
+	case sb.slots <- struct{}{}:
+	default:
+		return funl.Value{}, extensions.ErrEvalBusy
+	}
+	resultCh := make(chan evalResult, 1)
+	go func() {
+		defer func() {
+			<-sb.slots
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				resultCh <- evalResult{err: fmt.Errorf("%v", r)}
+			}
+		}()
+
+		frame := funl.NewTopFrameWithInterpreter(sb.interpreter)
+		frame.SetInProcCall(true)
+		sourceItem := &funl.Item{
+			Type: funl.ValueItem,
+			Data: funl.Value{Kind: funl.StringValue, Data: source},
+		}
+		resultCh <- evalResult{value: funl.HandleEvalOP(frame, []*funl.Item{sourceItem})}
+	}()
+
+	select {
+	case result := <-resultCh:
+		return result.value, result.err
+	case <-time.After(sandboxEvalTimeout * time.Second):
+		return funl.Value{}, fmt.Errorf("evaluation timeout")
+	}
+}
+
+// evalArgs evaluates FunL expression which should produce
+// list of arguments for main procedure
+func (sb *sandbox) evalArgs(source string) ([]*funl.Item, error) {
+	argListVal, err := sb.eval(source)
+	if err != nil {
+		return nil, err
+	}
+	if argListVal.Kind != funl.ListValue {
+		return nil, fmt.Errorf("args-funl should evaluate to list")
+	}
+	args := []*funl.Item{}
+	lit := funl.NewListIterator(argListVal)
+	for {
+		nextArg := lit.Next()
+		if nextArg == nil {
+			break
+		}
+		args = append(args, &funl.Item{Type: funl.ValueItem, Data: *nextArg})
+	}
+	return args, nil
+}
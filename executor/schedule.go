@@ -0,0 +1,447 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultScheduleHistory = 10
+
+// concurrency policies for scheduled runs
+const (
+	concurrencyAllow   = "allow"
+	concurrencyForbid  = "forbid"
+	concurrencyReplace = "replace"
+)
+
+// scheduleRun is result of one scheduled run
+type scheduleRun struct {
+	run      int
+	appID    int
+	started  time.Time
+	finished time.Time
+	status   string
+	result   string
+	failure  string
+	rtErr    *rtError
+}
+
+// schedule starts app from given spec by cron expression or interval
+type schedule struct {
+	name        string
+	spec        *appSpec
+	cronText    string
+	cron        *cronExpr
+	interval    time.Duration
+	concurrency string
+	history     int
+	stopCh      chan struct{}
+
+	lock     sync.Mutex
+	runs     []*scheduleRun
+	runCount int
+	skipped  int
+	nextRun  time.Time
+	running  map[int]*app
+}
+
+type scheduleStore struct {
+	m    map[string]*schedule
+	lock sync.RWMutex
+}
+
+func newScheduleStore() *scheduleStore {
+	return &scheduleStore{
+		m: map[string]*schedule{},
+	}
+}
+
+func (ss *scheduleStore) add(sch *schedule) error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if _, found := ss.m[sch.name]; found {
+		return fmt.Errorf("schedule already exists: %s", sch.name)
+	}
+	ss.m[sch.name] = sch
+	return nil
+}
+
+func (ss *scheduleStore) get(name string) (*schedule, bool) {
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	sch, found := ss.m[name]
+	return sch, found
+}
+
+func (ss *scheduleStore) getAll() []*schedule {
+	schedules := []*schedule{}
+
+	ss.lock.RLock()
+	defer ss.lock.RUnlock()
+
+	for _, sch := range ss.m {
+		schedules = append(schedules, sch)
+	}
+	return schedules
+}
+
+func (ss *scheduleStore) del(name string) (*schedule, bool) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	sch, found := ss.m[name]
+	delete(ss.m, name)
+	return sch, found
+}
+
+func (sch *schedule) nextTime(after time.Time) (time.Time, bool) {
+	if sch.cron != nil {
+		return sch.cron.next(after)
+	}
+	return after.Add(sch.interval), true
+}
+
+func (sch *schedule) addRun(run *scheduleRun) {
+	sch.runs = append(sch.runs, run)
+	if l := len(sch.runs); l > sch.history {
+		sch.runs = sch.runs[l-sch.history:]
+	}
+}
+
+func (sch *schedule) info() map[string]interface{} {
+	sch.lock.Lock()
+	defer sch.lock.Unlock()
+
+	runs := []map[string]interface{}{}
+	for _, run := range sch.runs {
+		runInfo := map[string]interface{}{
+			"run":     run.run,
+			"app-id":  run.appID,
+			"started": run.started.Format(time.RFC3339),
+			"status":  run.status,
+		}
+		if !run.finished.IsZero() {
+			runInfo["finished"] = run.finished.Format(time.RFC3339)
+		}
+		if run.result != "" {
+			runInfo["result"] = run.result
+		}
+		if run.failure != "" {
+			runInfo["error"] = run.failure
+		}
+		if run.rtErr != nil {
+			runInfo["error-details"] = run.rtErr
+		}
+		runs = append(runs, runInfo)
+	}
+	running := []int{}
+	for appID := range sch.running {
+		running = append(running, appID)
+	}
+	schInfo := map[string]interface{}{
+		"name":        sch.name,
+		"pack":        sch.spec.pack,
+		"concurrency": sch.concurrency,
+		"history":     sch.history,
+		"skipped":     sch.skipped,
+		"running":     running,
+		"runs":        runs,
+	}
+	if sch.cron != nil {
+		schInfo["cron"] = sch.cronText
+	} else {
+		schInfo["interval"] = int(sch.interval / time.Second)
+	}
+	if !sch.nextRun.IsZero() {
+		schInfo["next-run"] = sch.nextRun.Format(time.RFC3339)
+	}
+	return schInfo
+}
+
+// runScheduled starts one run of schedule according to concurrency policy
+// and records its result when it's finished
+func (runner *Executor) runScheduled(sch *schedule) {
+	sch.lock.Lock()
+	toReplace := []*app{}
+	if len(sch.running) > 0 {
+		switch sch.concurrency {
+		case concurrencyForbid:
+			sch.skipped++
+			sch.lock.Unlock()
+			return
+		case concurrencyReplace:
+			for _, appData := range sch.running {
+				toReplace = append(toReplace, appData)
+			}
+		}
+	}
+	sch.runCount++
+	runNum := sch.runCount
+	sch.lock.Unlock()
+
+	for _, appData := range toReplace {
+		appData.lock.Lock()
+		appData.stopping = true
+		appData.lock.Unlock()
+		if !runner.appstore.sendExit(appData, "exit-for-replace") {
+			log.Printf("Scheduled app %d (%s) did not exit when replaced", appData.id, appData.name)
+		}
+	}
+
+	grp := &appGroup{
+		name:     sch.name,
+		kind:     groupSchedule,
+		spec:     sch.spec,
+		replicas: 1,
+	}
+	appInstance := runner.startApp(grp, 0, 1, 0)
+	run := &scheduleRun{
+		run:     runNum,
+		appID:   appInstance.id,
+		started: appInstance.started,
+		status:  "running",
+	}
+	sch.lock.Lock()
+	sch.running[appInstance.id] = appInstance
+	sch.addRun(run)
+	sch.lock.Unlock()
+
+	<-appInstance.done
+	status := appInstance.outcome()
+
+	sch.lock.Lock()
+	defer sch.lock.Unlock()
+
+	delete(sch.running, appInstance.id)
+	run.finished = time.Now()
+	run.status = status
+	run.failure = appInstance.failure
+	run.rtErr = appInstance.rtErr
+	if status == "succeeded" {
+		run.result = fmt.Sprintf("%#v", appInstance.retval)
+	}
+}
+
+// runSchedule triggers runs until schedule is removed
+func (runner *Executor) runSchedule(sch *schedule) {
+	for {
+		next, found := sch.nextTime(time.Now())
+		if !found {
+			log.Printf("No next run time found for schedule: %s", sch.name)
+			return
+		}
+		sch.lock.Lock()
+		sch.nextRun = next
+		sch.lock.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-sch.stopCh:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		go runner.runScheduled(sch)
+	}
+}
+
+func (runner *Executor) handleScheduleCreate(w http.ResponseWriter, r *http.Request) {
+	type scheduleRequest struct {
+		Name           string          `json:"name"`
+		Pack           string          `json:"pack"`
+		Args           json.RawMessage `json:"args"`
+		HaveCTXasLast  bool            `json:"ctx-last"`
+		HaveCTXasFirst bool            `json:"ctx-1st"`
+		Cron           string          `json:"cron"`
+		Interval       int             `json:"interval"`
+		Concurrency    string          `json:"concurrency"`
+		History        int             `json:"history"`
+		Modules        []string        `json:"modules"`
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req scheduleRequest
+	err = json.Unmarshal(body, &req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "schedule name assumed", http.StatusBadRequest)
+		return
+	}
+	if err := runner.checkDataDirName(req.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if (req.Cron == "") == (req.Interval == 0) {
+		http.Error(w, "either cron or interval assumed", http.StatusBadRequest)
+		return
+	}
+	if req.Interval < 0 || req.History < 0 {
+		http.Error(w, "interval and history should not be negative", http.StatusBadRequest)
+		return
+	}
+	if req.History == 0 {
+		req.History = defaultScheduleHistory
+	}
+	switch req.Concurrency {
+	case "":
+		req.Concurrency = concurrencyAllow
+	case concurrencyAllow, concurrencyForbid, concurrencyReplace:
+	default:
+		http.Error(w, fmt.Sprintf("invalid concurrency policy: %s", req.Concurrency), http.StatusBadRequest)
+		return
+	}
+	var cron *cronExpr
+	if req.Cron != "" {
+		cron, err = parseCron(req.Cron)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, found := cron.next(time.Now()); !found {
+			http.Error(w, fmt.Sprintf("cron expression never matches: %s", req.Cron), http.StatusBadRequest)
+			return
+		}
+	}
+
+	code, packFound := runner.getPack(req.Pack)
+	if !packFound {
+		http.Error(w, "package not found", http.StatusNotFound)
+		return
+	}
+	if err := checkModuleNames(req.Modules); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	modules, err := runner.allowedModules(code, req.Modules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := validatePack(req.Pack, code, modules); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	args, status, err := runner.makeArgs(code, req.Args)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	sch := &schedule{
+		name: req.Name,
+		spec: &appSpec{
+			pack:           req.Pack,
+			code:           code,
+			args:           args,
+			haveCTXasFirst: req.HaveCTXasFirst,
+			haveCTXasLast:  req.HaveCTXasLast,
+			restartPolicy:  restartNever,
+			modules:        modules,
+		},
+		cronText:    req.Cron,
+		cron:        cron,
+		interval:    time.Duration(req.Interval) * time.Second,
+		concurrency: req.Concurrency,
+		history:     req.History,
+		stopCh:      make(chan struct{}),
+		running:     map[int]*app{},
+	}
+	if err := runner.schedules.add(sch); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	go runner.runSchedule(sch)
+
+	resp, err := json.Marshal(sch.info())
+	if err != nil {
+		log.Printf("%v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(resp)
+}
+
+func (runner *Executor) handleScheduleGetAll(w http.ResponseWriter, r *http.Request) {
+	schedulesResp := []map[string]interface{}{}
+	for _, sch := range runner.schedules.getAll() {
+		schedulesResp = append(schedulesResp, sch.info())
+	}
+	resp, err := json.Marshal(&schedulesResp)
+	if err != nil {
+		log.Printf("Error in reading schedules: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (runner *Executor) handleScheduleGet(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	name := pathParts[len(pathParts)-1]
+	sch, found := runner.schedules.get(name)
+	if !found {
+		http.Error(w, "schedule not found", http.StatusNotFound)
+		return
+	}
+	resp, err := json.Marshal(sch.info())
+	if err != nil {
+		log.Printf("Error in reading schedule: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (runner *Executor) handleScheduleDelete(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(r.URL.Path, "/")
+	name := pathParts[len(pathParts)-1]
+	sch, found := runner.schedules.del(name)
+	if !found {
+		http.Error(w, "schedule not found", http.StatusNotFound)
+		return
+	}
+	close(sch.stopCh)
+}
+
+// GetScheduleHandler gets handler for scheduled apps
+func (runner *Executor) GetScheduleHandler() (hCol, hRes func(w http.ResponseWriter, r *http.Request)) {
+	hCol = func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			runner.handleScheduleCreate(w, r)
+		case "GET":
+			runner.handleScheduleGetAll(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+	hRes = func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			runner.handleScheduleGet(w, r)
+		case "DELETE":
+			runner.handleScheduleDelete(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+	return
+}
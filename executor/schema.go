@@ -0,0 +1,262 @@
+package executor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// jsonSchema is supported subset of JSON Schema
+type jsonSchema struct {
+	Type                 interface{}            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *json.RawMessage       `json:"additionalProperties"`
+	Items                *json.RawMessage       `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+}
+
+// decodeJSONValue decodes JSON so that numbers keep information
+// whether those are integers
+func decodeJSONValue(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// jsonTypeOf returns JSON Schema type name of value
+func jsonTypeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	}
+	return "unknown"
+}
+
+func (schema *jsonSchema) typeMatches(value interface{}) bool {
+	if schema.Type == nil {
+		return true
+	}
+	types := []interface{}{schema.Type}
+	if list, ok := schema.Type.([]interface{}); ok {
+		types = list
+	}
+	valueType := jsonTypeOf(value)
+	for _, t := range types {
+		if t == valueType || (t == "number" && valueType == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks value against schema, path tells location of value
+func (schema *jsonSchema) validate(value interface{}, path string) error {
+	if !schema.typeMatches(value) {
+		return fmt.Errorf("%s: %s assumed (got: %s)", path, schema.Type, jsonTypeOf(value))
+	}
+	if schema.Enum != nil {
+		found := false
+		for _, allowed := range schema.Enum {
+			if reflect.DeepEqual(normalizeJSON(allowed), normalizeJSON(value)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value not allowed", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		if schema.Minimum != nil && f < *schema.Minimum {
+			return fmt.Errorf("%s: should be at least %v", path, *schema.Minimum)
+		}
+		if schema.Maximum != nil && f > *schema.Maximum {
+			return fmt.Errorf("%s: should be at most %v", path, *schema.Maximum)
+		}
+	case string:
+		l := len([]rune(v))
+		if schema.MinLength != nil && l < *schema.MinLength {
+			return fmt.Errorf("%s: length should be at least %d", path, *schema.MinLength)
+		}
+		if schema.MaxLength != nil && l > *schema.MaxLength {
+			return fmt.Errorf("%s: length should be at most %d", path, *schema.MaxLength)
+		}
+	case []interface{}:
+		if schema.MinItems != nil && len(v) < *schema.MinItems {
+			return fmt.Errorf("%s: should have at least %d items", path, *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(v) > *schema.MaxItems {
+			return fmt.Errorf("%s: should have at most %d items", path, *schema.MaxItems)
+		}
+		if schema.Items != nil {
+			if err := schema.validateItems(v, path); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, found := v[name]; !found {
+				return fmt.Errorf("%s: missing property: %s", path, name)
+			}
+		}
+		for name, propValue := range v {
+			propPath := fmt.Sprintf("%s.%s", path, name)
+			if propSchema, found := schema.Properties[name]; found {
+				if err := propSchema.validate(propValue, propPath); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := schema.validateAdditional(propValue, propPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateItems validates array items, items is either
+// schema for all items or array of schemas (one for each position)
+func (schema *jsonSchema) validateItems(items []interface{}, path string) error {
+	var tuple []*jsonSchema
+	if err := json.Unmarshal(*schema.Items, &tuple); err == nil {
+		if len(items) > len(tuple) {
+			return fmt.Errorf("%s: should have at most %d items", path, len(tuple))
+		}
+		for i, item := range items {
+			if err := tuple[i].validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var itemSchema jsonSchema
+	if err := json.Unmarshal(*schema.Items, &itemSchema); err != nil {
+		return fmt.Errorf("invalid schema items: %v", err)
+	}
+	for i, item := range items {
+		if err := itemSchema.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAdditional validates property not listed in properties,
+// additionalProperties is either boolean or schema
+func (schema *jsonSchema) validateAdditional(value interface{}, path string) error {
+	if schema.AdditionalProperties == nil {
+		return nil
+	}
+	var allowed bool
+	if err := json.Unmarshal(*schema.AdditionalProperties, &allowed); err == nil {
+		if !allowed {
+			return fmt.Errorf("%s: unknown property", path)
+		}
+		return nil
+	}
+	var propSchema jsonSchema
+	if err := json.Unmarshal(*schema.AdditionalProperties, &propSchema); err != nil {
+		return fmt.Errorf("invalid schema additionalProperties: %v", err)
+	}
+	return propSchema.validate(value, path)
+}
+
+// normalizeJSON converts numbers to float64 so that values can be compared
+func normalizeJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case float64:
+		return v
+	case []interface{}:
+		items := []interface{}{}
+		for _, item := range v {
+			items = append(items, normalizeJSON(item))
+		}
+		return items
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, item := range v {
+			m[k] = normalizeJSON(item)
+		}
+		return m
+	}
+	return value
+}
+
+// FunL type names used in args-types and matching JSON types
+var funlArgTypes = map[string][]string{
+	"int":    {"integer"},
+	"float":  {"number", "integer"},
+	"string": {"string"},
+	"bool":   {"boolean"},
+	"list":   {"array"},
+	"map":    {"object"},
+	"any":    nil,
+}
+
+// validateArgTypes checks positional arguments against FunL type spec
+func validateArgTypes(types []string, jsonArgs []byte) error {
+	value, err := decodeJSONValue(jsonArgs)
+	if err != nil {
+		return err
+	}
+	args, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("arguments should be in array")
+	}
+	if len(args) != len(types) {
+		return fmt.Errorf("%d arguments assumed (got: %d)", len(types), len(args))
+	}
+	for i, typeName := range types {
+		jsonTypes, known := funlArgTypes[typeName]
+		if !known {
+			return fmt.Errorf("unknown type in package manifest: %s", typeName)
+		}
+		if jsonTypes == nil {
+			continue
+		}
+		argType := jsonTypeOf(args[i])
+		matches := false
+		for _, t := range jsonTypes {
+			if t == argType {
+				matches = true
+			}
+		}
+		if !matches {
+			return fmt.Errorf("argument %d: %s assumed (got: %s)", i+1, typeName, argType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package executor
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		ok     bool
+	}{
+		{"string", `{"type":"string"}`, `"abc"`, true},
+		{"string got int", `{"type":"string"}`, `1`, false},
+		{"integer", `{"type":"integer"}`, `3`, true},
+		{"integer as float", `{"type":"integer"}`, `3.0`, true},
+		{"integer got float", `{"type":"integer"}`, `3.5`, false},
+		{"integer got string", `{"type":"integer"}`, `"3"`, false},
+		{"number got integer", `{"type":"number"}`, `3`, true},
+		{"number got bool", `{"type":"number"}`, `true`, false},
+		{"boolean got string", `{"type":"boolean"}`, `"true"`, false},
+		{"null got object", `{"type":"null"}`, `{}`, false},
+		{"array got object", `{"type":"array"}`, `{}`, false},
+		{"object got array", `{"type":"object"}`, `[]`, false},
+		{"type list", `{"type":["string","null"]}`, `null`, true},
+		{"type list mismatch", `{"type":["string","null"]}`, `1`, false},
+		{"no type", `{}`, `[1,"a"]`, true},
+		{"items", `{"type":"array","items":{"type":"integer"}}`, `[1,2]`, true},
+		{"items mismatch", `{"type":"array","items":{"type":"integer"}}`, `[1,"a"]`, false},
+		{"tuple", `{"items":[{"type":"string"},{"type":"integer"}]}`, `["a",1]`, true},
+		{"tuple mismatch", `{"items":[{"type":"string"},{"type":"integer"}]}`, `[1,"a"]`, false},
+		{"tuple too long", `{"items":[{"type":"string"}]}`, `["a","b"]`, false},
+		{"property", `{"properties":{"a":{"type":"string"}}}`, `{"a":"x"}`, true},
+		{"property mismatch", `{"properties":{"a":{"type":"string"}}}`, `{"a":1}`, false},
+		{"nested mismatch", `{"properties":{"a":{"properties":{"b":{"type":"boolean"}}}}}`, `{"a":{"b":0}}`, false},
+		{"required missing", `{"type":"object","required":["a"]}`, `{}`, false},
+		{"additional false", `{"properties":{},"additionalProperties":false}`, `{"a":1}`, false},
+		{"additional schema", `{"additionalProperties":{"type":"integer"}}`, `{"a":1}`, true},
+		{"additional mismatch", `{"additionalProperties":{"type":"integer"}}`, `{"a":"x"}`, false},
+		{"enum", `{"enum":[1,"a"]}`, `1.0`, true},
+		{"enum mismatch", `{"enum":[1,"a"]}`, `"1"`, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var schema jsonSchema
+			if err := json.Unmarshal([]byte(tc.schema), &schema); err != nil {
+				t.Fatalf("invalid schema: %v", err)
+			}
+			value, err := decodeJSONValue([]byte(tc.value))
+			if err != nil {
+				t.Fatalf("invalid value: %v", err)
+			}
+			err = schema.validate(value, "args")
+			if tc.ok && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
+
+func TestValidateArgTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		types []string
+		args  string
+		ok    bool
+	}{
+		{"matching", []string{"int", "float", "string", "bool", "list", "map"}, `[1, 2, "a", true, [], {}]`, true},
+		{"float accepts int", []string{"float"}, `[2]`, true},
+		{"int got float", []string{"int"}, `[2.5]`, false},
+		{"string got int", []string{"string"}, `[1]`, false},
+		{"bool got string", []string{"bool"}, `["true"]`, false},
+		{"list got map", []string{"list"}, `[{}]`, false},
+		{"map got list", []string{"map"}, `[[]]`, false},
+		{"any", []string{"any"}, `[null]`, true},
+		{"unknown type", []string{"char"}, `["a"]`, false},
+		{"too few", []string{"int", "int"}, `[1]`, false},
+		{"too many", []string{"int"}, `[1, 2]`, false},
+		{"not array", []string{"int"}, `{"a": 1}`, false},
+		{"invalid json", []string{"int"}, `[1`, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateArgTypes(tc.types, []byte(tc.args))
+			if tc.ok && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Errorf("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	defaultSuperviseInterval = 1  // seconds
+	maxRestartDelay          = 30 // seconds
+)
+
+// restart policies
+const (
+	restartNever     = "never"
+	restartOnFailure = "on-failure"
+	restartAlways    = "always"
+)
+
+func isValidRestartPolicy(policy string) bool {
+	switch policy {
+	case restartNever, restartOnFailure, restartAlways:
+		return true
+	}
+	return false
+}
+
+// takeRestart tells whether exiting app should be restarted,
+// restart which was requested earlier (by supervisor) is consumed here
+func (runner *Executor) takeRestart(a *app, failed bool) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.orphaned {
+		// replacement was already started when app was orphaned
+		return false
+	}
+	if a.restarting {
+		return true
+	}
+	if a.stopping {
+		return false
+	}
+	switch a.group.spec.restartPolicy {
+	case restartAlways:
+		a.restarting = true
+	case restartOnFailure:
+		a.restarting = failed
+	}
+	return a.restarting
+}
+
+// restartApp asks running app to exit so that it gets restarted,
+// if app does not exit in time it's left orphaned and replacement is started
+func (runner *Executor) restartApp(a *app, reason string) {
+	a.lock.Lock()
+	if a.stopping || a.restarting {
+		a.lock.Unlock()
+		return
+	}
+	a.restarting = true
+	a.lock.Unlock()
+
+	log.Printf("Restarting app %d (%s): %s", a.id, a.name, reason)
+	go func() {
+		if runner.appstore.sendExit(a, "exit-for-restart") {
+			return
+		}
+		a.lock.Lock()
+		a.orphaned = true
+		a.stopping = true
+		a.lock.Unlock()
+
+		// restarting is still set so group is kept when orphan is removed
+		log.Printf("App %d (%s) did not exit, leaving it orphaned", a.id, a.name)
+		runner.appstore.del(a)
+		runner.restartReplica(a)
+	}()
+}
+
+// restartReplica starts new instance to replace exited one
+// (after delay depending on amount of restarts)
+func (runner *Executor) restartReplica(a *app) {
+	delay := a.restarts
+	if delay > maxRestartDelay {
+		delay = maxRestartDelay
+	}
+	go func() {
+		time.Sleep(time.Duration(delay) * time.Second)
+
+		grp := a.group
+		if !runner.appstore.hasGroup(grp) {
+			return
+		}
+		replicas, missing := runner.appstore.missingReplicas(grp)
+		for _, replica := range missing {
+			if replica == a.replica {
+				runner.startApp(grp, replica, replicas, a.restarts+1)
+			}
+		}
+	}()
+}
+
+// supervise restarts apps which have stopped heartbeating
+func (runner *Executor) supervise() {
+	ticker := time.NewTicker(defaultSuperviseInterval * time.Second)
+	for range ticker.C {
+		for _, appData := range runner.appstore.getAll() {
+			if appData.group.spec.restartPolicy == restartNever {
+				continue
+			}
+			if appData.isStale() {
+				runner.restartApp(appData, "heartbeat stale")
+			}
+		}
+	}
+}
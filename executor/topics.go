@@ -0,0 +1,368 @@
+package executor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anssihalmeaho/funl/funl"
+	"github.com/anssihalmeaho/funl/std"
+	"github.com/anssihalmeaho/mzq/bro"
+	"github.com/anssihalmeaho/mzq/queue"
+)
+
+const (
+	topicQueueSize     = 100
+	subscriptionSize   = 100
+	topicPollInterval  = 20 * time.Millisecond
+	sseKeepalivePeriod = 15 * time.Second
+)
+
+// topicState is broker queue registered for topic and
+// subscribers to which messages from queue are delivered
+type topicState struct {
+	que  *queue.Queue
+	subs map[chan funl.Value]bool
+	done chan struct{}
+}
+
+// topicHub is process-wide default broker, topics are queue names
+// of broker, messages in topic are delivered to all subscribers
+type topicHub struct {
+	name   string
+	broker funl.Value
+	frame  *funl.Frame
+	topics map[string]*topicState
+	lock   sync.Mutex
+}
+
+func newTopicHub(name, addr string, peers []string) (*topicHub, error) {
+	interpreter := funl.NewInterpreter()
+	if err := std.InitSTD(interpreter); err != nil {
+		return nil, fmt.Errorf("Error in std-lib init (%v)", err)
+	}
+	if err := funl.InitFunSourceSTD(interpreter); err != nil {
+		return nil, fmt.Errorf("Error in std-lib (fun source) init (%v)", err)
+	}
+	frame := funl.NewTopFrameWithInterpreter(interpreter)
+	frame.SetInProcCall(true)
+
+	peerValues := []funl.Value{}
+	for _, peer := range peers {
+		peerValues = append(peerValues, funl.Value{Kind: funl.StringValue, Data: peer})
+	}
+	options := makeMap(frame, map[string]funl.Value{
+		"own-name": {Kind: funl.StringValue, Data: name},
+		"own-addr": {Kind: funl.StringValue, Data: addr},
+		"addrs":    funl.MakeListOfValues(frame, peerValues),
+	})
+	lit := funl.NewListIterator(bro.GetNewBroker("new-broker")(frame, []funl.Value{options}))
+	ok, errText, broker := *lit.Next(), *lit.Next(), *lit.Next()
+	if !ok.Data.(bool) {
+		return nil, fmt.Errorf("%s", errText.Data.(string))
+	}
+	return &topicHub{
+		name:   name,
+		broker: broker,
+		frame:  frame,
+		topics: map[string]*topicState{},
+	}, nil
+}
+
+// publish sends message to topic via broker
+func (hub *topicHub) publish(topic string, message funl.Value) error {
+	args := []funl.Value{
+		hub.broker,
+		{Kind: funl.StringValue, Data: hub.name},
+		{Kind: funl.StringValue, Data: topic},
+		message,
+	}
+	lit := funl.NewListIterator(bro.GetSendMsg("send-msg")(hub.frame, args))
+	ok, errText := *lit.Next(), *lit.Next()
+	if !ok.Data.(bool) {
+		return fmt.Errorf("%s", errText.Data.(string))
+	}
+	return nil
+}
+
+// subscribe returns channel to which messages of topic are delivered,
+// queue for topic is registered to broker for first subscriber
+func (hub *topicHub) subscribe(topic string) chan funl.Value {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	ch := make(chan funl.Value, subscriptionSize)
+	state, found := hub.topics[topic]
+	if !found {
+		queVal := queue.GetNewQueue("new-queue")(hub.frame, []funl.Value{{Kind: funl.IntValue, Data: topicQueueSize}})
+		regArgs := []funl.Value{hub.broker, {Kind: funl.StringValue, Data: topic}, queVal}
+		bro.GetRegQueue("reg-queue")(hub.frame, regArgs)
+		state = &topicState{
+			que:  queVal.Data.(*queue.OpaqueQueue).GetQinside(),
+			subs: map[chan funl.Value]bool{},
+			done: make(chan struct{}),
+		}
+		hub.topics[topic] = state
+		go hub.pump(topic, state)
+	}
+	state.subs[ch] = true
+	return ch
+}
+
+// unsubscribe removes subscription, queue of topic is unregistered
+// when last subscriber leaves
+func (hub *topicHub) unsubscribe(ch chan funl.Value) bool {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	for topic, state := range hub.topics {
+		if !state.subs[ch] {
+			continue
+		}
+		delete(state.subs, ch)
+		if len(state.subs) == 0 {
+			bro.GetUnRegQueue("unreg-queue")(hub.frame, []funl.Value{hub.broker, {Kind: funl.StringValue, Data: topic}})
+			close(state.done)
+			delete(hub.topics, topic)
+		}
+		return true
+	}
+	return false
+}
+
+// pump reads messages from topic queue and delivers those to subscribers,
+// message is dropped for subscriber which channel is full
+func (hub *topicHub) pump(topic string, state *topicState) {
+	for {
+		item, hasAny := state.que.GetNoWait()
+		if !hasAny {
+			select {
+			case <-state.done:
+				return
+			case <-time.After(topicPollInterval):
+			}
+			continue
+		}
+		message, ok := item.(funl.Value)
+		if !ok {
+			continue
+		}
+		hub.lock.Lock()
+		for ch := range state.subs {
+			select {
+			case ch <- message:
+			default:
+			}
+		}
+		hub.lock.Unlock()
+	}
+}
+
+// subscriberCounts returns amount of subscribers for each topic
+func (hub *topicHub) subscriberCounts() map[string]int {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+
+	counts := map[string]int{}
+	for topic, state := range hub.topics {
+		counts[topic] = len(state.subs)
+	}
+	return counts
+}
+
+// SetBroker creates default broker with given node name, address and
+// comma separated list of peer broker addresses
+func (runner *Executor) SetBroker(name, addr, peerList string) error {
+	peers := []string{}
+	for _, peer := range strings.Split(peerList, ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	hub, err := newTopicHub(name, addr, peers)
+	if err != nil {
+		return err
+	}
+	runner.topics = hub
+	return nil
+}
+
+// getPublishProc returns procedure for publishing message to topic:
+// publish(<topic:string> <message>) -> list(<ok:bool> <error:string>)
+func (runner *Executor) getPublishProc() func(*funl.Frame, []funl.Value) funl.Value {
+	return func(frame *funl.Frame, arguments []funl.Value) funl.Value {
+		if l := len(arguments); l != 2 {
+			funl.RunTimeError2(frame, "publish: wrong amount of arguments (%d), need two", l)
+		}
+		if arguments[0].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "publish: requires string value as topic")
+		}
+		errText := ""
+		if err := runner.topics.publish(arguments[0].Data.(string), arguments[1]); err != nil {
+			errText = err.Error()
+		}
+		return funl.MakeListOfValues(frame, []funl.Value{
+			{Kind: funl.BoolValue, Data: errText == ""},
+			{Kind: funl.StringValue, Data: errText},
+		})
+	}
+}
+
+// getSubscribeProc returns procedure for subscribing topic:
+// subscribe(<topic:string>) -> <channel>
+func (runner *Executor) getSubscribeProc(subscriber *app) func(*funl.Frame, []funl.Value) funl.Value {
+	return func(frame *funl.Frame, arguments []funl.Value) funl.Value {
+		if l := len(arguments); l != 1 {
+			funl.RunTimeError2(frame, "subscribe: wrong amount of arguments (%d), need one", l)
+		}
+		if arguments[0].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "subscribe: requires string value as topic")
+		}
+		ch := runner.topics.subscribe(arguments[0].Data.(string))
+
+		subscriber.lock.Lock()
+		defer subscriber.lock.Unlock()
+
+		subscriber.subscriptions = append(subscriber.subscriptions, ch)
+		return funl.Value{Kind: funl.ChanValue, Data: ch}
+	}
+}
+
+// getUnsubscribeProc returns procedure for ending subscription:
+// unsubscribe(<channel>) -> <found:bool>
+func (runner *Executor) getUnsubscribeProc() func(*funl.Frame, []funl.Value) funl.Value {
+	return func(frame *funl.Frame, arguments []funl.Value) funl.Value {
+		if l := len(arguments); l != 1 {
+			funl.RunTimeError2(frame, "unsubscribe: wrong amount of arguments (%d), need one", l)
+		}
+		ch, ok := arguments[0].Data.(chan funl.Value)
+		if arguments[0].Kind != funl.ChanValue || !ok {
+			funl.RunTimeError2(frame, "unsubscribe: requires channel value")
+		}
+		return funl.Value{Kind: funl.BoolValue, Data: runner.topics.unsubscribe(ch)}
+	}
+}
+
+// endSubscriptions removes subscriptions of exited app
+func (runner *Executor) endSubscriptions(a *app) {
+	a.lock.Lock()
+	subscriptions := a.subscriptions
+	a.subscriptions = nil
+	a.lock.Unlock()
+
+	for _, ch := range subscriptions {
+		runner.topics.unsubscribe(ch)
+	}
+}
+
+func (runner *Executor) handleTopicGetAll(w http.ResponseWriter, r *http.Request) {
+	counts := runner.topics.subscriberCounts()
+	topics := []string{}
+	for topic := range counts {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	topicsResp := []map[string]interface{}{}
+	for _, topic := range topics {
+		topicsResp = append(topicsResp, map[string]interface{}{
+			"topic":       topic,
+			"subscribers": counts[topic],
+		})
+	}
+	resp, err := json.Marshal(map[string]interface{}{
+		"broker": runner.topics.name,
+		"topics": topicsResp,
+	})
+	if err != nil {
+		log.Printf("Error in reading topics: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (runner *Executor) handleTopicPublish(w http.ResponseWriter, r *http.Request, topic string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	message, err := runner.argsEval.decodeJSON(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid message: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := runner.topics.publish(topic, message); err != nil {
+		log.Printf("Error in publishing to topic (%s): %v", topic, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// handleTopicSubscribe streams messages of topic as server-sent events
+// (JSON encoded) until client closes connection
+func (runner *Executor) handleTopicSubscribe(w http.ResponseWriter, r *http.Request, topic string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	ch := runner.topics.subscribe(topic)
+	defer runner.topics.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(sseKeepalivePeriod)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case message := <-ch:
+			data, err := runner.argsEval.encodeJSON(message)
+			if err != nil {
+				fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+			} else {
+				fmt.Fprintf(w, "data: %s\n\n", data)
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// GetTopicHandler gets handler for publishing to and subscribing topics of default broker
+func (runner *Executor) GetTopicHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if runner.topics == nil {
+			http.Error(w, "broker not available", http.StatusServiceUnavailable)
+			return
+		}
+		topic := strings.Trim(strings.TrimPrefix(r.URL.Path, "/topics"), "/")
+
+		switch {
+		case r.Method == "GET" && topic == "":
+			runner.handleTopicGetAll(w, r)
+		case topic == "":
+			http.Error(w, "assuming topic", http.StatusBadRequest)
+		case r.Method == "GET":
+			runner.handleTopicSubscribe(w, r, topic)
+		case r.Method == "POST":
+			runner.handleTopicPublish(w, r, topic)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+}
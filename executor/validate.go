@@ -0,0 +1,219 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anssihalmeaho/funl/funl"
+	"github.com/anssihalmeaho/funl/std"
+)
+
+const maxSettle = 60 // seconds
+
+// parseErrHandler turns syntax error to panic which parser
+// returns as error (default handler exits process)
+type parseErrHandler struct{}
+
+func (peh *parseErrHandler) HandleParseError(errorText string) {
+	panic(fmt.Errorf("%s", errorText))
+}
+
+var (
+	builtinModsOnce sync.Once
+	builtinMods     *funl.Interpreter
+)
+
+// builtinModules returns interpreter which contains all modules available
+// for apps without importing from package (std-lib and extensions)
+func builtinModules() *funl.Interpreter {
+	builtinModsOnce.Do(func() {
+		source := "ns main\n\nmain = proc()\n\tproc() true end\nend\n\nendns\n"
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		tw.WriteHeader(&tar.Header{Name: "builtins.fnl", Mode: 0600, Size: int64(len(source))})
+		tw.Write([]byte(source))
+		tw.Close()
+
+		retval, err := funl.FunlMainWithPackageContent(buf.Bytes(), nil, "main", "builtins.fpack", std.InitSTD)
+		if err != nil {
+			panic(fmt.Errorf("Error in reading builtin modules (%v)", err))
+		}
+		builtinMods = retval.Data.(funl.FuncValue).AccessLink.GetTopFrame().Interpreter
+	})
+	return builtinMods
+}
+
+func isBuiltinModule(name string) bool {
+	sid, found := funl.SymIDMap.Get(name)
+	return found && builtinModules().NsDir.HasNS(sid)
+}
+
+// validatePack checks before app is started that all modules in package
+// can be parsed, main module has main procedure and imported modules are found
+// (and builtin modules are in allow-list if it's given)
+func validatePack(pack string, code []byte, allowed []string) error {
+	mods, err := funl.GetModsFromTar(code)
+	if err != nil {
+		return fmt.Errorf("invalid package: %v", err)
+	}
+	_, packFile := filepath.Split(pack)
+	mainMod := strings.Split(packFile, ".")[0]
+	if _, found := mods[mainMod]; !found {
+		return fmt.Errorf("main module not found in package: %s.fnl", mainMod)
+	}
+
+	modNames := []string{}
+	for modName := range mods {
+		modNames = append(modNames, modName)
+	}
+	sort.Strings(modNames)
+
+	errs := []string{}
+	for _, modName := range modNames {
+		if err := validateModule(modName, mods[modName], modName == mainMod, mods, allowed); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func validateModule(modName string, content []byte, isMain bool, mods map[string][]byte, allowed []string) (err error) {
+	srcFileName := modName + ".fnl"
+	parser := funl.NewParser(funl.NewDefaultOperators(), &srcFileName)
+	parser.SetErrorHandler(&parseErrHandler{})
+	nsName, nspace, err := func() (nsName string, nspace *funl.NSpace, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+		}()
+		return parser.Parse(string(content))
+	}()
+	if err != nil {
+		return err
+	}
+
+	if isMain {
+		if nsName != "main" {
+			return fmt.Errorf("%s: main module should have namespace main (got: %s)", srcFileName, nsName)
+		}
+		if _, found := nspace.Syms.GetByName("main"); !found {
+			return fmt.Errorf("%s: main procedure not found", srcFileName)
+		}
+	} else if nsName != modName {
+		return fmt.Errorf("%s: namespace should be %s (got: %s)", srcFileName, modName, nsName)
+	}
+
+	for _, imp := range moduleImports(nspace, string(content)) {
+		if _, found := mods[imp.name]; found {
+			continue
+		}
+		if !isBuiltinModule(imp.name) {
+			return fmt.Errorf("%s: line %d: imported module not found: %s", srcFileName, imp.line, imp.name)
+		}
+		if !isModuleAllowed(imp.name, allowed) {
+			return fmt.Errorf("%s: line %d: imported module not allowed: %s", srcFileName, imp.line, imp.name)
+		}
+	}
+	return nil
+}
+
+// moduleImport is module imported in source and line of import
+type moduleImport struct {
+	name string
+	line int
+}
+
+// moduleImports returns modules imported in namespace and inside its
+// functions and procedures (sorted by line)
+func moduleImports(nspace *funl.NSpace, content string) []moduleImport {
+	lines := map[string]int{}
+	var addImports func(ns funl.NSpace, line int)
+	var walkItem func(item *funl.Item)
+	addImports = func(ns funl.NSpace, line int) {
+		for sid := range ns.OtherNS {
+			name := funl.SymIDMap.AsString(sid)
+			if _, found := lines[name]; !found {
+				lines[name] = importLine(content, name, line)
+			}
+		}
+		if ns.Syms != nil {
+			for _, item := range ns.Syms.AsMap() {
+				walkItem(item)
+			}
+		}
+	}
+	walkItem = func(item *funl.Item) {
+		switch item.Type {
+		case funl.ValueItem:
+			if value := item.Data.(funl.Value); value.Kind == funl.FuncProtoValue {
+				function := value.Data.(*funl.Function)
+				addImports(function.NSpace, function.Lineno)
+				if function.Body != nil {
+					walkItem(function.Body)
+				}
+			}
+		case funl.OperCallItem:
+			for _, operand := range item.Data.(funl.OpCall).Operands {
+				walkItem(operand)
+			}
+		}
+	}
+	addImports(*nspace, 1)
+
+	imports := []moduleImport{}
+	for name, line := range lines {
+		imports = append(imports, moduleImport{name: name, line: line})
+	}
+	sort.Slice(imports, func(i, j int) bool {
+		if imports[i].line != imports[j].line {
+			return imports[i].line < imports[j].line
+		}
+		return imports[i].name < imports[j].name
+	})
+	return imports
+}
+
+// importLine returns line of first import of module in source
+// (or given default line if it's not found)
+func importLine(content, name string, defaultLine int) int {
+	importRe := regexp.MustCompile(`(^|[^\w-])import\s+` + regexp.QuoteMeta(name) + `($|[^\w-])`)
+	for i, line := range strings.Split(content, "\n") {
+		if importRe.MatchString(line) {
+			return i + 1
+		}
+	}
+	return defaultLine
+}
+
+// settle waits given period and returns failure of first
+// app instance which failed during it (empty if none failed)
+func settle(instances []*app, period time.Duration) string {
+	deadline := time.Now().Add(period)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for time.Now().Before(deadline) {
+		for _, appInstance := range instances {
+			select {
+			case <-appInstance.done:
+				if appInstance.outcome() == "failed" {
+					return fmt.Sprintf("app %d (%s): %s", appInstance.id, appInstance.name, appInstance.failure)
+				}
+			default:
+			}
+		}
+		<-ticker.C
+	}
+	return ""
+}
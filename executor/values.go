@@ -0,0 +1,43 @@
+package executor
+
+import (
+	"github.com/anssihalmeaho/funl/funl"
+)
+
+// makeMap makes FunL map from string keys and values
+func makeMap(frame *funl.Frame, entries map[string]funl.Value) funl.Value {
+	operands := []*funl.Item{}
+	for k, v := range entries {
+		operands = append(operands, ctxEntry(k, v)...)
+	}
+	return funl.HandleMapOP(frame, operands)
+}
+
+// makeStringMap makes FunL map with string values
+func makeStringMap(frame *funl.Frame, entries map[string]string) funl.Value {
+	operands := []*funl.Item{}
+	for k, v := range entries {
+		operands = append(operands, ctxEntry(k, funl.Value{Kind: funl.StringValue, Data: v})...)
+	}
+	return funl.HandleMapOP(frame, operands)
+}
+
+// mapEntries returns entries of FunL map which have string keys
+func mapEntries(frame *funl.Frame, mapv funl.Value) map[string]funl.Value {
+	entries := map[string]funl.Value{}
+	keyvals := funl.HandleKeyvalsOP(frame, []*funl.Item{&funl.Item{Type: funl.ValueItem, Data: mapv}})
+	kvListIter := funl.NewListIterator(keyvals)
+	for {
+		nextKV := kvListIter.Next()
+		if nextKV == nil {
+			break
+		}
+		kvIter := funl.NewListIterator(*nextKV)
+		keyv := *(kvIter.Next())
+		valv := *(kvIter.Next())
+		if keyv.Kind == funl.StringValue {
+			entries[keyv.Data.(string)] = valv
+		}
+	}
+	return entries
+}
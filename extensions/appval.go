@@ -1,50 +1,435 @@
 package extensions
 
 import (
+	"apprunner/codeserver"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/anssihalmeaho/funl/funl"
 	"github.com/anssihalmeaho/funl/std"
 )
 
+const watchBufferSize = 100
+
+// appvalWatcher gets change events of values under token
+// (and only of given name if it's not empty), owner is
+// interpreter of app which started watching
+type appvalWatcher struct {
+	token   string
+	name    string
+	ch      chan funl.Value
+	owner   *funl.Interpreter
+	dropped int
+}
+
+// appvalEntry is stored value, expires is zero if value does not expire
+type appvalEntry struct {
+	value   funl.Value
+	expires time.Time
+}
+
+func (e *appvalEntry) isExpired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// entryLock serializes update of entry and other writes of it,
+// updater is interpreter of app whose update is running
+type entryLock struct {
+	sync.Mutex
+	updater *funl.Interpreter
+	users   int
+}
+
 type appvalStore struct {
-	m map[string]map[string]funl.Value
+	m          map[string]map[string]*appvalEntry
+	watchers   []*appvalWatcher
+	persistent map[string]bool
+	backend    codeserver.BucketStore
+	acls       map[string]*tokenACL
 	sync.RWMutex
+
+	// entry locks are taken before store lock
+	entryLocks     map[string]*entryLock
+	entryLocksLock sync.Mutex
 }
 
 func newAppvalStore() *appvalStore {
 	return &appvalStore{
-		m: make(map[string]map[string]funl.Value),
+		m:          make(map[string]map[string]*appvalEntry),
+		persistent: make(map[string]bool),
+		acls:       make(map[string]*tokenACL),
+		entryLocks: make(map[string]*entryLock),
+	}
+}
+
+// lockEntry locks entry for writing and returns function for unlocking it,
+// caller is interpreter of app which writes (nil if not app). Locking fails
+// if caller's app is running update of entry (as it would wait for itself)
+func (av *appvalStore) lockEntry(caller *funl.Interpreter, name, token string, update bool) (func(), error) {
+	key := token + keySep + name
+	av.entryLocksLock.Lock()
+	el, found := av.entryLocks[key]
+	if !found {
+		el = &entryLock{}
+		av.entryLocks[key] = el
+	}
+	if caller != nil && el.updater == caller {
+		av.entryLocksLock.Unlock()
+		return nil, fmt.Errorf("value is being updated by same app")
 	}
+	el.users++
+	av.entryLocksLock.Unlock()
+
+	el.Lock()
+	if update {
+		av.entryLocksLock.Lock()
+		el.updater = caller
+		av.entryLocksLock.Unlock()
+	}
+	return func() {
+		av.entryLocksLock.Lock()
+		el.updater = nil
+		el.users--
+		if el.users == 0 {
+			delete(av.entryLocks, key)
+		}
+		av.entryLocksLock.Unlock()
+		el.Unlock()
+	}, nil
 }
 
-func (av *appvalStore) Put(name, token string, value funl.Value) {
+// notify sends change event to watchers, store is assumed to be locked,
+// event is dropped for watcher which has full buffer and overflow
+// event (with count of dropped events) is sent when there's room again
+func (av *appvalStore) notify(name, token string, old, value funl.Value) {
+	var event funl.Value
+	for _, watcher := range av.watchers {
+		if watcher.token != token || (watcher.name != "" && watcher.name != name) {
+			continue
+		}
+		if event.Kind != funl.MapValue {
+			event = makeEvent(name, old, value)
+		}
+		if watcher.dropped > 0 {
+			select {
+			case watcher.ch <- makeOverflowEvent(watcher.dropped):
+				watcher.dropped = 0
+			default:
+				watcher.dropped++
+				continue
+			}
+		}
+		select {
+		case watcher.ch <- event:
+		default:
+			watcher.dropped++
+		}
+	}
+}
+
+func (av *appvalStore) Watch(owner *funl.Interpreter, name, token string) chan funl.Value {
 	av.Lock()
 	defer av.Unlock()
 
+	watcher := &appvalWatcher{
+		token: token,
+		name:  name,
+		ch:    make(chan funl.Value, watchBufferSize),
+		owner: owner,
+	}
+	av.watchers = append(av.watchers, watcher)
+	return watcher.ch
+}
+
+// removeWatchers removes all watchers of owner
+func (av *appvalStore) removeWatchers(owner *funl.Interpreter) {
+	av.Lock()
+	defer av.Unlock()
+
+	watchers := []*appvalWatcher{}
+	for _, watcher := range av.watchers {
+		if watcher.owner != owner {
+			watchers = append(watchers, watcher)
+		}
+	}
+	av.watchers = watchers
+}
+
+// RemoveAppWatchers removes appval watchers of app which runs
+// in given interpreter (when app has exited)
+func RemoveAppWatchers(interpreter *funl.Interpreter) {
+	appValStore.removeWatchers(interpreter)
+}
+
+func (av *appvalStore) Unwatch(ch chan funl.Value) bool {
+	av.Lock()
+	defer av.Unlock()
+
+	for i, watcher := range av.watchers {
+		if watcher.ch == ch {
+			av.watchers = append(av.watchers[:i], av.watchers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns entry which has not expired, store is assumed to be locked
+func (av *appvalStore) lookup(name, token string) (*appvalEntry, bool) {
+	entry, found := av.m[token][name]
+	if !found || entry.isExpired(time.Now()) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// write sets entry and notifies watchers, store is assumed to be locked
+func (av *appvalStore) write(name, token string, value funl.Value, expires time.Time) {
 	innerm, found := av.m[token]
 	if !found {
-		innerm = make(map[string]funl.Value)
+		innerm = make(map[string]*appvalEntry)
 		av.m[token] = innerm
 	}
-	av.m[token][name] = value
+	old := funl.Value{Kind: funl.StringValue, Data: ""}
+	if entry, found := av.lookup(name, token); found {
+		old = entry.value
+	}
+	entry := &appvalEntry{value: value, expires: expires}
+	innerm[name] = entry
+	av.saveEntry(name, token, entry)
+	av.notify(name, token, old, value)
+}
+
+// remove deletes entry and notifies watchers, store is assumed to be locked
+func (av *appvalStore) remove(name, token string, old funl.Value) {
+	delete(av.m[token], name)
+	if len(av.m[token]) == 0 {
+		delete(av.m, token)
+	}
+	av.deleteEntry(name, token)
+	av.notify(name, token, old, funl.Value{Kind: funl.StringValue, Data: ""})
+}
+
+// Put writes value, value expires after ttl if it's greater than zero,
+// error is returned only if caller app is running update of value
+func (av *appvalStore) Put(caller *funl.Interpreter, name, token string, value funl.Value, ttl time.Duration) error {
+	unlock, err := av.lockEntry(caller, name, token, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	av.Lock()
+	defer av.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	av.write(name, token, value, expires)
+	return nil
 }
 
 func (av *appvalStore) Get(name, token string) (funl.Value, bool) {
 	av.RLock()
 	defer av.RUnlock()
 
-	v, found := av.m[token][name]
+	entry, found := av.lookup(name, token)
 	if !found {
-		v = funl.Value{Kind: funl.StringValue, Data: ""}
+		return funl.Value{Kind: funl.StringValue, Data: ""}, false
 	}
-	return v, found
+	return entry.value, true
+}
+
+// Del removes value, error is returned only if caller app is running update of value
+func (av *appvalStore) Del(caller *funl.Interpreter, name, token string) (bool, error) {
+	unlock, err := av.lockEntry(caller, name, token, false)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	av.Lock()
+	defer av.Unlock()
+
+	entry, found := av.lookup(name, token)
+	if !found {
+		return false, nil
+	}
+	av.remove(name, token, entry.value)
+	return true, nil
+}
+
+func (av *appvalStore) Keys(token string) []string {
+	av.RLock()
+	defer av.RUnlock()
+
+	now := time.Now()
+	names := []string{}
+	for name, entry := range av.m[token] {
+		if !entry.isExpired(now) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Tokens returns tokens which caller can read
+func (av *appvalStore) Tokens(caller string) []string {
+	av.RLock()
+	defer av.RUnlock()
+
+	now := time.Now()
+	tokens := []string{}
+	for token, innerm := range av.m {
+		if !av.canAccess(token, caller, false) {
+			continue
+		}
+		for _, entry := range innerm {
+			if !entry.isExpired(now) {
+				tokens = append(tokens, token)
+				break
+			}
+		}
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// CompareAndSwap writes new value if current value equals to expected one,
+// missing value does not equal to any value (expiration time is kept)
+func (av *appvalStore) CompareAndSwap(frame *funl.Frame, name, token string, expected, value funl.Value) (bool, error) {
+	unlock, err := av.lockEntry(frame.GetTopFrame().Interpreter, name, token, false)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	av.Lock()
+	defer av.Unlock()
+
+	current, found := av.lookup(name, token)
+	if !found || !valuesEqual(frame, current.value, expected) {
+		return false, nil
+	}
+	av.write(name, token, value, current.expires)
+	return true, nil
+}
+
+// Update calls updater procedure with found-flag and current value and
+// writes value it returns (expiration time is kept). Entry is locked during
+// call so other writes of it wait, store itself is not locked so updater
+// may use other values too
+func (av *appvalStore) Update(frame *funl.Frame, name, token string, updater funl.Value) (funl.Value, error) {
+	unlock, err := av.lockEntry(frame.GetTopFrame().Interpreter, name, token, true)
+	if err != nil {
+		return funl.Value{}, err
+	}
+	defer unlock()
+
+	av.RLock()
+	current, found := av.lookup(name, token)
+	av.RUnlock()
+
+	currentValue := funl.Value{Kind: funl.StringValue, Data: ""}
+	if found {
+		currentValue = current.value
+	}
+	operands := []*funl.Item{
+		&funl.Item{Type: funl.ValueItem, Data: updater},
+		&funl.Item{Type: funl.ValueItem, Data: funl.Value{Kind: funl.BoolValue, Data: found}},
+		&funl.Item{Type: funl.ValueItem, Data: currentValue},
+	}
+	value := funl.HandleCallOP(frame, operands)
+
+	av.Lock()
+	defer av.Unlock()
+
+	var expires time.Time
+	if found {
+		expires = current.expires
+	}
+	av.write(name, token, value, expires)
+	return value, nil
+}
+
+// removeExpired removes expired values and notifies watchers about those
+func (av *appvalStore) removeExpired() {
+	av.Lock()
+	defer av.Unlock()
+
+	now := time.Now()
+	for token, innerm := range av.m {
+		for name, entry := range innerm {
+			if entry.isExpired(now) {
+				av.remove(name, token, entry.value)
+			}
+		}
+	}
+}
+
+// expirer removes expired values periodically
+func (av *appvalStore) expirer() {
+	for range time.Tick(time.Second) {
+		av.removeExpired()
+	}
+}
+
+var (
+	eqFuncOnce sync.Once
+	eqFunc     funl.Value
+	valFrame   = funl.NewTopFrameWithInterpreter(funl.NewInterpreter())
+)
+
+// makeEvent makes change event map
+func makeEvent(name string, old, value funl.Value) funl.Value {
+	operands := []*funl.Item{
+		&funl.Item{Type: funl.ValueItem, Data: funl.Value{Kind: funl.StringValue, Data: "name"}},
+		&funl.Item{Type: funl.ValueItem, Data: funl.Value{Kind: funl.StringValue, Data: name}},
+		&funl.Item{Type: funl.ValueItem, Data: funl.Value{Kind: funl.StringValue, Data: "old"}},
+		&funl.Item{Type: funl.ValueItem, Data: old},
+		&funl.Item{Type: funl.ValueItem, Data: funl.Value{Kind: funl.StringValue, Data: "new"}},
+		&funl.Item{Type: funl.ValueItem, Data: value},
+	}
+	return funl.HandleMapOP(valFrame, operands)
+}
+
+// makeOverflowEvent makes event which tells how many events were dropped
+func makeOverflowEvent(dropped int) funl.Value {
+	operands := []*funl.Item{
+		&funl.Item{Type: funl.ValueItem, Data: funl.Value{Kind: funl.StringValue, Data: "overflow"}},
+		&funl.Item{Type: funl.ValueItem, Data: funl.Value{Kind: funl.BoolValue, Data: true}},
+		&funl.Item{Type: funl.ValueItem, Data: funl.Value{Kind: funl.StringValue, Data: "dropped"}},
+		&funl.Item{Type: funl.ValueItem, Data: funl.Value{Kind: funl.IntValue, Data: dropped}},
+	}
+	return funl.HandleMapOP(valFrame, operands)
+}
+
+// valuesEqual compares values as eq -operator does
+func valuesEqual(frame *funl.Frame, v1, v2 funl.Value) bool {
+	eqFuncOnce.Do(func() {
+		sourceItem := &funl.Item{
+			Type: funl.ValueItem,
+			Data: funl.Value{Kind: funl.StringValue, Data: "func(a b) eq(a b) end"},
+		}
+		eqFunc = funl.HandleEvalOP(valFrame, []*funl.Item{sourceItem})
+	})
+	operands := []*funl.Item{
+		&funl.Item{Type: funl.ValueItem, Data: eqFunc},
+		&funl.Item{Type: funl.ValueItem, Data: v1},
+		&funl.Item{Type: funl.ValueItem, Data: v2},
+	}
+	return funl.HandleCallOP(frame, operands).Data.(bool)
 }
 
 var appValStore *appvalStore
 
 func init() {
 	appValStore = newAppvalStore()
+	go appValStore.expirer()
 	funl.AddExtensionInitializer(initAppval)
 }
 
@@ -60,6 +445,50 @@ func initAppval(interpreter *funl.Interpreter) (err error) {
 			Name:   "setval",
 			Getter: getSetval,
 		},
+		{
+			Name:   "delval",
+			Getter: getDelval,
+		},
+		{
+			Name:   "getkeys",
+			Getter: getGetkeys,
+		},
+		{
+			Name:   "tokens",
+			Getter: getTokens,
+		},
+		{
+			Name:   "cas",
+			Getter: getCas,
+		},
+		{
+			Name:   "update",
+			Getter: getUpdate,
+		},
+		{
+			Name:   "persist",
+			Getter: getPersist,
+		},
+		{
+			Name:   "claim",
+			Getter: getClaim,
+		},
+		{
+			Name:   "grant",
+			Getter: getGrant,
+		},
+		{
+			Name:   "revoke",
+			Getter: getRevoke,
+		},
+		{
+			Name:   "watch",
+			Getter: getWatch,
+		},
+		{
+			Name:   "unwatch",
+			Getter: getUnwatch,
+		},
 	}
 	err = std.SetSTDFunctions(topFrame, stdModuleName, stdFuncs, interpreter)
 	return
@@ -78,6 +507,7 @@ func getGetval(name string) std.StdFuncType {
 		}
 		tokenv := arguments[0].Data.(string)
 		namev := arguments[1].Data.(string)
+		checkTokenAccess(frame, name, tokenv, false)
 		val, found := appValStore.Get(namev, tokenv)
 
 		values := []funl.Value{
@@ -93,6 +523,121 @@ func getGetval(name string) std.StdFuncType {
 }
 
 func getSetval(name string) std.StdFuncType {
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if l := len(arguments); l != 3 && l != 4 {
+			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), need three or four", name, l)
+		}
+		if arguments[0].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "%s: requires string value", name)
+		}
+		if arguments[1].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "%s: requires string value", name)
+		}
+		tokenv := arguments[0].Data.(string)
+		namev := arguments[1].Data.(string)
+		var ttl time.Duration
+		if len(arguments) == 4 {
+			switch ttlv := arguments[3]; ttlv.Kind {
+			case funl.IntValue:
+				ttl = time.Duration(ttlv.Data.(int)) * time.Second
+			case funl.FloatValue:
+				ttl = time.Duration(ttlv.Data.(float64) * float64(time.Second))
+			default:
+				funl.RunTimeError2(frame, "%s: requires int or float value as time-to-live", name)
+			}
+			if ttl <= 0 {
+				funl.RunTimeError2(frame, "%s: time-to-live should be positive", name)
+			}
+		}
+		checkTokenAccess(frame, name, tokenv, true)
+		if err := appValStore.Put(frame.GetTopFrame().Interpreter, namev, tokenv, arguments[2], ttl); err != nil {
+			funl.RunTimeError2(frame, "%s: %v", name, err)
+		}
+		retVal = funl.Value{Kind: funl.BoolValue, Data: true}
+		return
+	}
+}
+
+func getDelval(name string) std.StdFuncType {
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if l := len(arguments); l != 2 {
+			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), need two", name, l)
+		}
+		if arguments[0].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "%s: requires string value", name)
+		}
+		if arguments[1].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "%s: requires string value", name)
+		}
+		tokenv := arguments[0].Data.(string)
+		namev := arguments[1].Data.(string)
+		checkTokenAccess(frame, name, tokenv, true)
+		removed, err := appValStore.Del(frame.GetTopFrame().Interpreter, namev, tokenv)
+		if err != nil {
+			funl.RunTimeError2(frame, "%s: %v", name, err)
+		}
+		retVal = funl.Value{Kind: funl.BoolValue, Data: removed}
+		return
+	}
+}
+
+func makeStringList(frame *funl.Frame, strs []string) funl.Value {
+	values := []funl.Value{}
+	for _, s := range strs {
+		values = append(values, funl.Value{Kind: funl.StringValue, Data: s})
+	}
+	return funl.MakeListOfValues(frame, values)
+}
+
+func getGetkeys(name string) std.StdFuncType {
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if l := len(arguments); l != 1 {
+			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), need one", name, l)
+		}
+		if arguments[0].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "%s: requires string value", name)
+		}
+		tokenv := arguments[0].Data.(string)
+		checkTokenAccess(frame, name, tokenv, false)
+		retVal = makeStringList(frame, appValStore.Keys(tokenv))
+		return
+	}
+}
+
+func getTokens(name string) std.StdFuncType {
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if l := len(arguments); l != 0 {
+			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), none assumed", name, l)
+		}
+		retVal = makeStringList(frame, appValStore.Tokens(callerName(frame)))
+		return
+	}
+}
+
+func getCas(name string) std.StdFuncType {
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if l := len(arguments); l != 4 {
+			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), need four", name, l)
+		}
+		if arguments[0].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "%s: requires string value", name)
+		}
+		if arguments[1].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "%s: requires string value", name)
+		}
+		tokenv := arguments[0].Data.(string)
+		namev := arguments[1].Data.(string)
+		checkTokenAccess(frame, name, tokenv, true)
+		swapped, err := appValStore.CompareAndSwap(frame, namev, tokenv, arguments[2], arguments[3])
+		if err != nil {
+			funl.RunTimeError2(frame, "%s: %v", name, err)
+		}
+		retVal = funl.Value{Kind: funl.BoolValue, Data: swapped}
+		return
+	}
+}
+
+func getUpdate(name string) std.StdFuncType {
 	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
 		if l := len(arguments); l != 3 {
 			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), need three", name, l)
@@ -103,10 +648,52 @@ func getSetval(name string) std.StdFuncType {
 		if arguments[1].Kind != funl.StringValue {
 			funl.RunTimeError2(frame, "%s: requires string value", name)
 		}
+		if k := arguments[2].Kind; k != funl.FunctionValue && k != funl.ExtProcValue {
+			funl.RunTimeError2(frame, "%s: requires function or procedure value", name)
+		}
 		tokenv := arguments[0].Data.(string)
 		namev := arguments[1].Data.(string)
-		appValStore.Put(namev, tokenv, arguments[2])
-		retVal = funl.Value{Kind: funl.BoolValue, Data: true}
+		checkTokenAccess(frame, name, tokenv, true)
+		value, err := appValStore.Update(frame, namev, tokenv, arguments[2])
+		if err != nil {
+			funl.RunTimeError2(frame, "%s: %v", name, err)
+		}
+		retVal = value
+		return
+	}
+}
+
+func getWatch(name string) std.StdFuncType {
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if l := len(arguments); l != 1 && l != 2 {
+			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), need one or two", name, l)
+		}
+		for _, arg := range arguments {
+			if arg.Kind != funl.StringValue {
+				funl.RunTimeError2(frame, "%s: requires string value", name)
+			}
+		}
+		tokenv := arguments[0].Data.(string)
+		namev := ""
+		if len(arguments) == 2 {
+			namev = arguments[1].Data.(string)
+		}
+		checkTokenAccess(frame, name, tokenv, false)
+		retVal = funl.Value{Kind: funl.ChanValue, Data: appValStore.Watch(frame.GetTopFrame().Interpreter, namev, tokenv)}
+		return
+	}
+}
+
+func getUnwatch(name string) std.StdFuncType {
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if l := len(arguments); l != 1 {
+			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), need one", name, l)
+		}
+		if arguments[0].Kind != funl.ChanValue {
+			funl.RunTimeError2(frame, "%s: requires channel value", name)
+		}
+		removed := appValStore.Unwatch(arguments[0].Data.(chan funl.Value))
+		retVal = funl.Value{Kind: funl.BoolValue, Data: removed}
 		return
 	}
 }
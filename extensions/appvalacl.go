@@ -0,0 +1,262 @@
+package extensions
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/anssihalmeaho/funl/funl"
+	"github.com/anssihalmeaho/funl/std"
+)
+
+const aclPrefix = "a\x00"
+
+// access levels which owner can grant, write access includes read access
+const (
+	readAccess  = "read"
+	writeAccess = "write"
+)
+
+// tokenACL is owner of claimed token and access granted
+// to other apps (by app/group name)
+type tokenACL struct {
+	Owner  string            `json:"owner"`
+	Grants map[string]string `json:"grants"`
+}
+
+// identities (and data directories) of apps by interpreter in which app runs
+var (
+	identities     = map[*funl.Interpreter]string{}
+	dataDirs       = map[*funl.Interpreter]string{}
+	identitiesLock sync.RWMutex
+)
+
+// SetAppIdentity sets name of app which runs in given interpreter,
+// appval uses it for access control
+func SetAppIdentity(interpreter *funl.Interpreter, name string) {
+	identitiesLock.Lock()
+	defer identitiesLock.Unlock()
+
+	identities[interpreter] = name
+}
+
+// ClearAppIdentity removes identity and data directory of interpreter (when app has exited)
+func ClearAppIdentity(interpreter *funl.Interpreter) {
+	identitiesLock.Lock()
+	defer identitiesLock.Unlock()
+
+	delete(identities, interpreter)
+	delete(dataDirs, interpreter)
+}
+
+// SetAppDataDir sets data directory of app which runs in given interpreter,
+// valuez uses it for restricting database paths
+func SetAppDataDir(interpreter *funl.Interpreter, dir string) {
+	identitiesLock.Lock()
+	defer identitiesLock.Unlock()
+
+	dataDirs[interpreter] = dir
+}
+
+// callerDataDir returns data directory of app which is calling, empty
+// if caller has no data directory
+func callerDataDir(frame *funl.Frame) string {
+	identitiesLock.RLock()
+	defer identitiesLock.RUnlock()
+
+	return dataDirs[frame.GetTopFrame().Interpreter]
+}
+
+// callerName returns name of app which is calling, empty if
+// caller is not app started by executor
+func callerName(frame *funl.Frame) string {
+	identitiesLock.RLock()
+	defer identitiesLock.RUnlock()
+
+	return identities[frame.GetTopFrame().Interpreter]
+}
+
+// canAccess tells whether caller has access to token, store is assumed to be locked
+func (av *appvalStore) canAccess(token, caller string, write bool) bool {
+	acl, found := av.acls[token]
+	if !found || (caller != "" && caller == acl.Owner) {
+		return true
+	}
+	access := acl.Grants[caller]
+	if caller == "" || access == "" {
+		return false
+	}
+	return !write || access == writeAccess
+}
+
+// checkAccess returns error if caller has no access to token
+func (av *appvalStore) checkAccess(token, caller string, write bool) error {
+	av.RLock()
+	defer av.RUnlock()
+
+	if av.canAccess(token, caller, write) {
+		return nil
+	}
+	access := readAccess
+	if write {
+		access = writeAccess
+	}
+	return fmt.Errorf("no %s access to token (app: %s)", access, caller)
+}
+
+// saveACL writes ACL of persistent token to storage, store is assumed to be locked
+func (av *appvalStore) saveACL(token string) {
+	acl, found := av.acls[token]
+	if av.backend == nil || !av.persistent[token] || !found {
+		return
+	}
+	data, err := json.Marshal(acl)
+	if err == nil {
+		err = av.backend.Put(aclPrefix+token, data)
+	}
+	if err != nil {
+		log.Printf("Error in storing appval token access (%s): %v", token, err)
+	}
+}
+
+// loadACL reads ACL of token from storage
+func (av *appvalStore) loadACL(token string, data []byte) error {
+	acl := &tokenACL{}
+	if err := json.Unmarshal(data, acl); err != nil {
+		return err
+	}
+	if acl.Grants == nil {
+		acl.Grants = map[string]string{}
+	}
+	av.acls[token] = acl
+	return nil
+}
+
+// hasValues tells whether token has values which have not expired, store is assumed to be locked
+func (av *appvalStore) hasValues(token string) bool {
+	now := time.Now()
+	for _, entry := range av.m[token] {
+		if !entry.isExpired(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// Claim makes caller owner of token, after that only owner
+// and apps which owner has granted access can use token,
+// only token without values can be claimed
+func (av *appvalStore) Claim(token, caller string) error {
+	av.Lock()
+	defer av.Unlock()
+
+	if caller == "" {
+		return fmt.Errorf("caller is not app")
+	}
+	if acl, found := av.acls[token]; found {
+		if acl.Owner == caller {
+			return nil
+		}
+		return fmt.Errorf("token already owned by other app")
+	}
+	if av.hasValues(token) {
+		return fmt.Errorf("token has values, only empty token can be claimed")
+	}
+	av.acls[token] = &tokenACL{Owner: caller, Grants: map[string]string{}}
+	av.saveACL(token)
+	return nil
+}
+
+// Grant gives access to token for given app, only owner can grant access
+// (empty access revokes access)
+func (av *appvalStore) Grant(token, caller, grantee, access string) error {
+	av.Lock()
+	defer av.Unlock()
+
+	acl, found := av.acls[token]
+	if !found {
+		return fmt.Errorf("token is not claimed")
+	}
+	if caller == "" || acl.Owner != caller {
+		return fmt.Errorf("only owner can change access (app: %s)", caller)
+	}
+	switch access {
+	case readAccess, writeAccess:
+		acl.Grants[grantee] = access
+	case "":
+		delete(acl.Grants, grantee)
+	default:
+		return fmt.Errorf("invalid access: %s (read or write assumed)", access)
+	}
+	av.saveACL(token)
+	return nil
+}
+
+func getClaim(name string) std.StdFuncType {
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if l := len(arguments); l != 1 {
+			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), need one", name, l)
+		}
+		if arguments[0].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "%s: requires string value", name)
+		}
+		if err := appValStore.Claim(arguments[0].Data.(string), callerName(frame)); err != nil {
+			funl.RunTimeError2(frame, "%s: %v", name, err)
+		}
+		retVal = funl.Value{Kind: funl.BoolValue, Data: true}
+		return
+	}
+}
+
+func getGrant(name string) std.StdFuncType {
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if l := len(arguments); l != 3 {
+			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), need three", name, l)
+		}
+		for _, arg := range arguments {
+			if arg.Kind != funl.StringValue {
+				funl.RunTimeError2(frame, "%s: requires string value", name)
+			}
+		}
+		tokenv := arguments[0].Data.(string)
+		grantee := arguments[1].Data.(string)
+		access := arguments[2].Data.(string)
+		if access == "" {
+			funl.RunTimeError2(frame, "%s: invalid access: '' (read or write assumed)", name)
+		}
+		if err := appValStore.Grant(tokenv, callerName(frame), grantee, access); err != nil {
+			funl.RunTimeError2(frame, "%s: %v", name, err)
+		}
+		retVal = funl.Value{Kind: funl.BoolValue, Data: true}
+		return
+	}
+}
+
+func getRevoke(name string) std.StdFuncType {
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if l := len(arguments); l != 2 {
+			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), need two", name, l)
+		}
+		for _, arg := range arguments {
+			if arg.Kind != funl.StringValue {
+				funl.RunTimeError2(frame, "%s: requires string value", name)
+			}
+		}
+		tokenv := arguments[0].Data.(string)
+		grantee := arguments[1].Data.(string)
+		if err := appValStore.Grant(tokenv, callerName(frame), grantee, ""); err != nil {
+			funl.RunTimeError2(frame, "%s: %v", name, err)
+		}
+		retVal = funl.Value{Kind: funl.BoolValue, Data: true}
+		return
+	}
+}
+
+// checkTokenAccess raises runtime error if caller has no access to token
+func checkTokenAccess(frame *funl.Frame, name, token string, write bool) {
+	if err := appValStore.checkAccess(token, callerName(frame), write); err != nil {
+		funl.RunTimeError2(frame, "%s: %v: %s", name, err, token)
+	}
+}
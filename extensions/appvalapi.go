@@ -0,0 +1,411 @@
+package extensions
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anssihalmeaho/funl/funl"
+)
+
+// valueType returns type name of value (as type -operator)
+func valueType(value funl.Value) string {
+	switch value.Kind {
+	case funl.IntValue:
+		return "int"
+	case funl.FloatValue:
+		return "float"
+	case funl.BoolValue:
+		return "bool"
+	case funl.StringValue:
+		return "string"
+	case funl.ListValue:
+		return "list"
+	case funl.MapValue:
+		return "map"
+	case funl.FuncProtoValue, funl.FunctionValue:
+		return "function"
+	case funl.ExtProcValue:
+		return "ext-proc"
+	case funl.ChanValue:
+		return "channel"
+	case funl.OpaqueValue:
+		if opaque, ok := value.Data.(funl.OpaqueAPI); ok {
+			return "opaque:" + opaque.TypeName()
+		}
+		return "opaque"
+	}
+	return "unknown"
+}
+
+// keyvalPairs returns key-value pairs of map
+func keyvalPairs(value funl.Value) [][2]funl.Value {
+	pairs := [][2]funl.Value{}
+	keyvals := funl.HandleKeyvalsOP(valFrame, []*funl.Item{&funl.Item{Type: funl.ValueItem, Data: value}})
+	lit := funl.NewListIterator(keyvals)
+	for next := lit.Next(); next != nil; next = lit.Next() {
+		kvIter := funl.NewListIterator(*next)
+		pairs = append(pairs, [2]funl.Value{*kvIter.Next(), *kvIter.Next()})
+	}
+	return pairs
+}
+
+var funlEscapes = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+
+// funlText returns value as FunL literal, false if value cannot be presented
+// as literal (text is then placeholder containing type)
+func funlText(value funl.Value) (string, bool) {
+	switch value.Kind {
+	case funl.IntValue, funl.FloatValue, funl.BoolValue:
+		return value.String(), true
+	case funl.StringValue:
+		return "'" + funlEscapes.Replace(value.Data.(string)) + "'", true
+	case funl.ListValue:
+		items := []string{}
+		lit := funl.NewListIterator(value)
+		for next := lit.Next(); next != nil; next = lit.Next() {
+			text, ok := funlText(*next)
+			if !ok {
+				return fmt.Sprintf("<%s>", valueType(value)), false
+			}
+			items = append(items, text)
+		}
+		return "list(" + strings.Join(items, " ") + ")", true
+	case funl.MapValue:
+		items := []string{}
+		for _, pair := range keyvalPairs(value) {
+			keyText, keyOK := funlText(pair[0])
+			valText, valOK := funlText(pair[1])
+			if !keyOK || !valOK {
+				return fmt.Sprintf("<%s>", valueType(value)), false
+			}
+			items = append(items, keyText+" "+valText)
+		}
+		sort.Strings(items)
+		return "map(" + strings.Join(items, " ") + ")", true
+	}
+	return fmt.Sprintf("<%s>", valueType(value)), false
+}
+
+// toJSON converts value to JSON compatible Go value, false
+// if value cannot be presented as JSON
+func toJSON(value funl.Value) (interface{}, bool) {
+	switch value.Kind {
+	case funl.IntValue, funl.FloatValue, funl.BoolValue, funl.StringValue:
+		return value.Data, true
+	case funl.ListValue:
+		items := []interface{}{}
+		lit := funl.NewListIterator(value)
+		for next := lit.Next(); next != nil; next = lit.Next() {
+			item, ok := toJSON(*next)
+			if !ok {
+				return nil, false
+			}
+			items = append(items, item)
+		}
+		return items, true
+	case funl.MapValue:
+		m := map[string]interface{}{}
+		for _, pair := range keyvalPairs(value) {
+			if pair[0].Kind != funl.StringValue {
+				return nil, false
+			}
+			item, ok := toJSON(pair[1])
+			if !ok {
+				return nil, false
+			}
+			m[pair[0].Data.(string)] = item
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+// fromJSON converts JSON decoded (with UseNumber) Go value to FunL value
+func fromJSON(data interface{}) (funl.Value, error) {
+	switch v := data.(type) {
+	case bool:
+		return funl.Value{Kind: funl.BoolValue, Data: v}, nil
+	case string:
+		return funl.Value{Kind: funl.StringValue, Data: v}, nil
+	case json.Number:
+		if i, err := strconv.Atoi(v.String()); err == nil {
+			return funl.Value{Kind: funl.IntValue, Data: i}, nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return funl.Value{}, err
+		}
+		return funl.Value{Kind: funl.FloatValue, Data: f}, nil
+	case []interface{}:
+		values := []funl.Value{}
+		for _, item := range v {
+			value, err := fromJSON(item)
+			if err != nil {
+				return funl.Value{}, err
+			}
+			values = append(values, value)
+		}
+		return funl.MakeListOfValues(valFrame, values), nil
+	case map[string]interface{}:
+		operands := []*funl.Item{}
+		for k, item := range v {
+			value, err := fromJSON(item)
+			if err != nil {
+				return funl.Value{}, err
+			}
+			operands = append(operands,
+				&funl.Item{Type: funl.ValueItem, Data: funl.Value{Kind: funl.StringValue, Data: k}},
+				&funl.Item{Type: funl.ValueItem, Data: value},
+			)
+		}
+		return funl.HandleMapOP(valFrame, operands), nil
+	}
+	return funl.Value{}, fmt.Errorf("null not supported")
+}
+
+// ErrEvalBusy is returned by value evaluator if too many evaluations are running
+var ErrEvalBusy = errors.New("too many evaluations running")
+
+// valueEvaluator evaluates FunL expression given as value
+var valueEvaluator func(source string) (funl.Value, error)
+
+// SetValueEvaluator sets evaluator for values given as FunL expressions,
+// evaluator should limit evaluation time and modules available
+func SetValueEvaluator(eval func(source string) (funl.Value, error)) {
+	valueEvaluator = eval
+}
+
+// parseValue reads value from request body, body is JSON or
+// FunL expression (evaluated with value evaluator) if format is funl
+func parseValue(body []byte, format string) (value funl.Value, err error) {
+	switch format {
+	case "", "json":
+		data, err := decodeJSON(body)
+		if err != nil {
+			return funl.Value{}, err
+		}
+		return fromJSON(data)
+	case "funl":
+		if valueEvaluator == nil {
+			return funl.Value{}, fmt.Errorf("funl format not available")
+		}
+		return valueEvaluator(string(body))
+	}
+	return funl.Value{}, fmt.Errorf("unknown format: %s (json or funl assumed)", format)
+}
+
+func decodeJSON(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var data interface{}
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func entryInfo(name string, entry *appvalEntry) map[string]interface{} {
+	text, _ := funlText(entry.value)
+	info := map[string]interface{}{
+		"name": name,
+		"type": valueType(entry.value),
+		"text": text,
+	}
+	if jsonv, ok := toJSON(entry.value); ok {
+		info["json"] = jsonv
+	}
+	if !entry.expires.IsZero() {
+		info["expires"] = entry.expires.Format(time.RFC3339)
+	}
+	return info
+}
+
+// tokenInfo returns information of token and its values, store is assumed to be locked
+func (av *appvalStore) tokenInfo(token string, withValues bool) (map[string]interface{}, bool) {
+	now := time.Now()
+	names := []string{}
+	for name, entry := range av.m[token] {
+		if !entry.isExpired(now) {
+			names = append(names, name)
+		}
+	}
+	acl, claimed := av.acls[token]
+	if len(names) == 0 && !claimed {
+		return nil, false
+	}
+	sort.Strings(names)
+	info := map[string]interface{}{
+		"token":      token,
+		"persistent": av.persistent[token],
+		"count":      len(names),
+	}
+	if claimed {
+		info["owner"] = acl.Owner
+		info["grants"] = acl.Grants
+	}
+	if withValues {
+		values := []map[string]interface{}{}
+		for _, name := range names {
+			values = append(values, entryInfo(name, av.m[token][name]))
+		}
+		info["values"] = values
+	}
+	return info, true
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	resp, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error in reading appval: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func handleAppvalGetAll(w http.ResponseWriter, r *http.Request) {
+	appValStore.RLock()
+	defer appValStore.RUnlock()
+
+	tokens := []string{}
+	for token := range appValStore.m {
+		tokens = append(tokens, token)
+	}
+	for token := range appValStore.acls {
+		if _, found := appValStore.m[token]; !found {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Strings(tokens)
+	tokensResp := []map[string]interface{}{}
+	for _, token := range tokens {
+		if info, found := appValStore.tokenInfo(token, false); found {
+			tokensResp = append(tokensResp, info)
+		}
+	}
+	writeJSON(w, tokensResp)
+}
+
+func handleAppvalGet(w http.ResponseWriter, r *http.Request, token, name string) {
+	appValStore.RLock()
+	defer appValStore.RUnlock()
+
+	if name == "" {
+		info, found := appValStore.tokenInfo(token, true)
+		if !found {
+			http.Error(w, "token not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, info)
+		return
+	}
+	entry, found := appValStore.lookup(name, token)
+	if !found {
+		http.Error(w, "value not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, entryInfo(name, entry))
+}
+
+func handleAppvalPut(w http.ResponseWriter, r *http.Request, token, name string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ttl time.Duration
+	if ttlText := r.URL.Query().Get("ttl"); ttlText != "" {
+		seconds, err := strconv.ParseFloat(ttlText, 64)
+		if err != nil || seconds <= 0 {
+			http.Error(w, "ttl should be positive number of seconds", http.StatusBadRequest)
+			return
+		}
+		ttl = time.Duration(seconds * float64(time.Second))
+	}
+	value, err := parseValue(body, r.URL.Query().Get("format"))
+	if errors.Is(err, ErrEvalBusy) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid value: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if name != "" {
+		appValStore.Put(nil, name, token, value, ttl)
+		return
+	}
+	// values for token are given in map
+	if value.Kind != funl.MapValue {
+		http.Error(w, "values of token should be given in map (object)", http.StatusBadRequest)
+		return
+	}
+	pairs := keyvalPairs(value)
+	for _, pair := range pairs {
+		if pair[0].Kind != funl.StringValue {
+			http.Error(w, "value names should be strings", http.StatusBadRequest)
+			return
+		}
+	}
+	for _, pair := range pairs {
+		appValStore.Put(nil, pair[0].Data.(string), token, pair[1], ttl)
+	}
+}
+
+func handleAppvalDelete(w http.ResponseWriter, r *http.Request, token, name string) {
+	if name != "" {
+		if removed, _ := appValStore.Del(nil, name, token); !removed {
+			http.Error(w, "value not found", http.StatusNotFound)
+		}
+		return
+	}
+	names := appValStore.Keys(token)
+	if len(names) == 0 {
+		http.Error(w, "token not found", http.StatusNotFound)
+		return
+	}
+	for _, name := range names {
+		appValStore.Del(nil, name, token)
+	}
+}
+
+// GetAppvalHandler gets handler for inspecting and editing appval values
+// (access control of tokens does not apply to it)
+func GetAppvalHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/appval"), "/", 3)
+		var token, name string
+		if len(pathParts) > 1 {
+			token = pathParts[1]
+		}
+		if len(pathParts) > 2 {
+			name = pathParts[2]
+		}
+
+		switch {
+		case r.Method == "GET" && token == "":
+			handleAppvalGetAll(w, r)
+		case token == "":
+			http.Error(w, "assuming token", http.StatusBadRequest)
+		case r.Method == "GET":
+			handleAppvalGet(w, r, token, name)
+		case r.Method == "PUT":
+			handleAppvalPut(w, r, token, name)
+		case r.Method == "DELETE":
+			handleAppvalDelete(w, r, token, name)
+		default:
+			http.Error(w, fmt.Sprintf("Unsupported method: %s", r.Method), http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package extensions
+
+import (
+	"apprunner/codeserver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anssihalmeaho/funl/funl"
+	"github.com/anssihalmeaho/funl/std"
+)
+
+// keys in storage: token marker is tokenPrefix+token, value is
+// valuePrefix+token+keySep+name and token access is aclPrefix+token
+const (
+	tokenPrefix = "t\x00"
+	valuePrefix = "v\x00"
+	keySep      = "\x00"
+)
+
+// appvalRecord is stored form of value
+type appvalRecord struct {
+	Value   string `json:"value"`
+	Expires string `json:"expires,omitempty"`
+}
+
+// serializer converts FunL values to text and back (with stdser)
+type serializer struct {
+	frame   *funl.Frame
+	encoder funl.Value
+	decoder funl.Value
+}
+
+var (
+	serOnce sync.Once
+	ser     *serializer
+)
+
+func getSerializer() *serializer {
+	serOnce.Do(func() {
+		interpreter := funl.NewInterpreter()
+		if err := std.InitSTD(interpreter); err != nil {
+			panic(fmt.Errorf("Error in std-lib init (%v)", err))
+		}
+		if err := funl.InitFunSourceSTD(interpreter); err != nil {
+			panic(fmt.Errorf("Error in std-lib (fun source) init (%v)", err))
+		}
+		frame := funl.NewTopFrameWithInterpreter(interpreter)
+		frame.SetInProcCall(true)
+		getEvaluated := func(source string) funl.Value {
+			sourceItem := &funl.Item{
+				Type: funl.ValueItem,
+				Data: funl.Value{Kind: funl.StringValue, Data: source},
+			}
+			return funl.HandleEvalOP(frame, []*funl.Item{sourceItem})
+		}
+		ser = &serializer{
+			frame:   frame,
+			encoder: getEvaluated("call(proc() import stdser import stdbytes proc(__v) _ _ b = call(stdser.encode __v): call(stdbytes.string b) end end)"),
+			decoder: getEvaluated("call(proc() import stdser import stdbytes proc(__s) call(stdser.decode call(stdbytes.str-to-bytes __s)) end end)"),
+		}
+	})
+	return ser
+}
+
+// isSerializable tells whether value can be encoded with stdser
+func isSerializable(value funl.Value) bool {
+	switch value.Kind {
+	case funl.IntValue, funl.FloatValue, funl.BoolValue, funl.StringValue:
+		return true
+	case funl.OpaqueValue:
+		opaque, ok := value.Data.(funl.OpaqueAPI)
+		return ok && opaque.TypeName() == "bytearray"
+	case funl.ListValue:
+		lit := funl.NewListIterator(value)
+		for next := lit.Next(); next != nil; next = lit.Next() {
+			if !isSerializable(*next) {
+				return false
+			}
+		}
+		return true
+	case funl.MapValue:
+		keyvals := funl.HandleKeyvalsOP(valFrame, []*funl.Item{&funl.Item{Type: funl.ValueItem, Data: value}})
+		return isSerializable(keyvals)
+	}
+	return false
+}
+
+func (s *serializer) encode(value funl.Value) string {
+	operands := []*funl.Item{
+		&funl.Item{Type: funl.ValueItem, Data: s.encoder},
+		&funl.Item{Type: funl.ValueItem, Data: value},
+	}
+	return funl.HandleCallOP(s.frame, operands).Data.(string)
+}
+
+func (s *serializer) decode(text string) (funl.Value, error) {
+	operands := []*funl.Item{
+		&funl.Item{Type: funl.ValueItem, Data: s.decoder},
+		&funl.Item{Type: funl.ValueItem, Data: funl.Value{Kind: funl.StringValue, Data: text}},
+	}
+	lit := funl.NewListIterator(funl.HandleCallOP(s.frame, operands))
+	ok, errText, value := *lit.Next(), *lit.Next(), *lit.Next()
+	if !ok.Data.(bool) {
+		return funl.Value{}, fmt.Errorf("%s", errText.Data.(string))
+	}
+	return value, nil
+}
+
+func valueKey(name, token string) string {
+	return valuePrefix + token + keySep + name
+}
+
+// saveEntry writes entry of persistent token to storage, store is assumed
+// to be locked (value which cannot be serialized is kept only in memory)
+func (av *appvalStore) saveEntry(name, token string, entry *appvalEntry) {
+	if av.backend == nil || !av.persistent[token] {
+		return
+	}
+	if !isSerializable(entry.value) {
+		av.backend.Del(valueKey(name, token))
+		return
+	}
+	record := appvalRecord{Value: getSerializer().encode(entry.value)}
+	if !entry.expires.IsZero() {
+		record.Expires = entry.expires.Format(time.RFC3339Nano)
+	}
+	data, err := json.Marshal(&record)
+	if err == nil {
+		err = av.backend.Put(valueKey(name, token), data)
+	}
+	if err != nil {
+		log.Printf("Error in storing appval value (%s/%s): %v", token, name, err)
+	}
+}
+
+// deleteEntry removes entry of persistent token from storage, store is assumed to be locked
+func (av *appvalStore) deleteEntry(name, token string) {
+	if av.backend == nil || !av.persistent[token] {
+		return
+	}
+	av.backend.Del(valueKey(name, token))
+}
+
+// Persist declares token persistent and writes its current values to storage
+func (av *appvalStore) Persist(token string) error {
+	av.Lock()
+	defer av.Unlock()
+
+	if av.backend == nil {
+		return fmt.Errorf("persistent storage not available")
+	}
+	if av.persistent[token] {
+		return nil
+	}
+	if err := av.backend.Put(tokenPrefix+token, []byte{}); err != nil {
+		return err
+	}
+	av.persistent[token] = true
+	av.saveACL(token)
+	now := time.Now()
+	for name, entry := range av.m[token] {
+		if !entry.isExpired(now) {
+			av.saveEntry(name, token, entry)
+		}
+	}
+	return nil
+}
+
+// load reads persistent tokens and their values from storage
+func (av *appvalStore) load() {
+	now := time.Now()
+	for _, key := range av.backend.Keys() {
+		switch {
+		case strings.HasPrefix(key, tokenPrefix):
+			av.persistent[strings.TrimPrefix(key, tokenPrefix)] = true
+		case strings.HasPrefix(key, aclPrefix):
+			token := strings.TrimPrefix(key, aclPrefix)
+			data, _ := av.backend.Get(key)
+			if err := av.loadACL(token, data); err != nil {
+				log.Printf("Error in reading appval token access (%s): %v", token, err)
+			}
+		case strings.HasPrefix(key, valuePrefix):
+			parts := strings.SplitN(strings.TrimPrefix(key, valuePrefix), keySep, 2)
+			if len(parts) != 2 {
+				continue
+			}
+			token, name := parts[0], parts[1]
+			if err := av.loadEntry(name, token, now); err != nil {
+				log.Printf("Error in reading appval value (%s/%s): %v", token, name, err)
+				av.backend.Del(key)
+			}
+		}
+	}
+}
+
+func (av *appvalStore) loadEntry(name, token string, now time.Time) error {
+	data, found := av.backend.Get(valueKey(name, token))
+	if !found {
+		return nil
+	}
+	var record appvalRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+	entry := &appvalEntry{}
+	if record.Expires != "" {
+		expires, err := time.Parse(time.RFC3339Nano, record.Expires)
+		if err != nil {
+			return err
+		}
+		entry.expires = expires
+		if entry.isExpired(now) {
+			av.backend.Del(valueKey(name, token))
+			return nil
+		}
+	}
+	value, err := getSerializer().decode(record.Value)
+	if err != nil {
+		return err
+	}
+	entry.value = value
+	innerm, found := av.m[token]
+	if !found {
+		innerm = make(map[string]*appvalEntry)
+		av.m[token] = innerm
+	}
+	innerm[name] = entry
+	return nil
+}
+
+// SetAppvalStorage sets storage for persistent appval tokens
+// and reads values stored earlier
+func SetAppvalStorage(backend codeserver.BucketStore) {
+	appValStore.Lock()
+	defer appValStore.Unlock()
+
+	appValStore.backend = backend
+	appValStore.load()
+}
+
+func getPersist(name string) std.StdFuncType {
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if l := len(arguments); l != 1 {
+			funl.RunTimeError2(frame, "%s: wrong amount of arguments (%d), need one", name, l)
+		}
+		if arguments[0].Kind != funl.StringValue {
+			funl.RunTimeError2(frame, "%s: requires string value", name)
+		}
+		tokenv := arguments[0].Data.(string)
+		checkTokenAccess(frame, name, tokenv, true)
+		if err := appValStore.Persist(tokenv); err != nil {
+			funl.RunTimeError2(frame, "%s: %v", name, err)
+		}
+		retVal = funl.Value{Kind: funl.BoolValue, Data: true}
+		return
+	}
+}
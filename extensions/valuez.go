@@ -1,6 +1,11 @@
 package extensions
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/anssihalmeaho/funl/funl"
 	"github.com/anssihalmeaho/funl/std"
 	"github.com/anssihalmeaho/fuvaluez/fuvaluez"
@@ -10,6 +15,90 @@ func init() {
 	funl.AddExtensionInitializer(initValuez)
 }
 
+// valuezRestricted tells whether valuez databases can be opened
+// only under data directory of app
+var valuezRestricted bool
+
+// SetValuezRestricted sets whether valuez.open is restricted to data directory of app,
+// relative paths are then relative to data directory
+func SetValuezRestricted(restricted bool) {
+	valuezRestricted = restricted
+}
+
+// restrictedPath returns database path under data directory of caller
+func restrictedPath(frame *funl.Frame, dbName string) (string, error) {
+	dir := callerDataDir(frame)
+	if dir == "" {
+		return "", fmt.Errorf("data directory not available")
+	}
+	return pathUnderDir(dir, dbName)
+}
+
+// pathUnderDir returns database path under directory, path is refused if it's
+// outside directory (also when symbolic links are resolved)
+func pathUnderDir(dir, dbName string) (string, error) {
+	path := dbName
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	if !isUnderDir(dir, path) {
+		return "", fmt.Errorf("path not under data directory: %s", dbName)
+	}
+	// valuez adds .db suffix to database file which may be link too
+	realDir, dirOk := resolveLinks(dir)
+	realPath, pathOk := resolveLinks(path)
+	realFile, fileOk := resolveLinks(path + ".db")
+	if !dirOk || !pathOk || !fileOk || !isUnderDir(realDir, realPath) || !isUnderDir(realDir, realFile) {
+		return "", fmt.Errorf("path not under data directory: %s", dbName)
+	}
+	return path, nil
+}
+
+// isUnderDir tells whether path is below directory (not directory itself)
+func isUnderDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveLinks resolves symbolic links of longest existing part of path,
+// returns false if some link can't be resolved
+func resolveLinks(path string) (string, bool) {
+	for existing := path; ; existing = filepath.Dir(existing) {
+		if _, err := os.Lstat(existing); err == nil {
+			real, err := filepath.EvalSymlinks(existing)
+			if err != nil {
+				return "", false
+			}
+			rest, _ := filepath.Rel(existing, path)
+			return filepath.Join(real, rest), true
+		}
+		if filepath.Dir(existing) == existing {
+			return path, true
+		}
+	}
+}
+
+// getVZOpen wraps valuez.open so that database path is checked if restricted
+func getVZOpen(name string) std.StdFuncType {
+	open := fuvaluez.GetVZOpen(name)
+	return func(frame *funl.Frame, arguments []funl.Value) (retVal funl.Value) {
+		if !valuezRestricted || len(arguments) != 1 || arguments[0].Kind != funl.StringValue {
+			return open(frame, arguments)
+		}
+		path, err := restrictedPath(frame, arguments[0].Data.(string))
+		if err != nil {
+			values := []funl.Value{
+				{Kind: funl.BoolValue, Data: false},
+				{Kind: funl.StringValue, Data: fmt.Sprintf("%s: %v", name, err)},
+				{Kind: funl.OpaqueValue, Data: &fuvaluez.OpaqueDB{}},
+			}
+			return funl.MakeListOfValues(frame, values)
+		}
+		return open(frame, []funl.Value{{Kind: funl.StringValue, Data: path}})
+	}
+}
+
 func convGetter(inGetter func(string) fuvaluez.FZProc) func(string) std.StdFuncType {
 	return func(name string) std.StdFuncType {
 		return std.StdFuncType(inGetter(name))
@@ -22,7 +111,7 @@ func initValuez(interpreter *funl.Interpreter) (err error) {
 	stdFuncs := []std.StdFuncInfo{
 		{
 			Name:   "open",
-			Getter: convGetter(fuvaluez.GetVZOpen),
+			Getter: getVZOpen,
 		},
 		{
 			Name:   "new-col",
@@ -0,0 +1,66 @@
+package extensions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathUnderDir(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "app")
+	outside := filepath.Join(base, "outside")
+	for _, d := range []string{dir, filepath.Join(dir, "sub"), outside} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"linkdir":   outside,
+		"linkdb.db": filepath.Join(outside, "x.db"),
+		"dangling":  filepath.Join(outside, "missing", "x"),
+		"inside":    filepath.Join(dir, "sub"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		dbName string
+		want   string
+		ok     bool
+	}{
+		{"relative", "mydb", filepath.Join(dir, "mydb"), true},
+		{"subdirectory", "sub/mydb", filepath.Join(dir, "sub", "mydb"), true},
+		{"absolute inside", filepath.Join(dir, "mydb"), filepath.Join(dir, "mydb"), true},
+		{"dot dot inside", "sub/../mydb", filepath.Join(dir, "mydb"), true},
+		{"link inside", "inside/mydb", filepath.Join(dir, "inside", "mydb"), true},
+		{"directory itself", ".", "", false},
+		{"empty", "", "", false},
+		{"parent", "..", "", false},
+		{"dot dot escape", "../outside/mydb", "", false},
+		{"nested dot dot escape", "sub/../../mydb", "", false},
+		{"absolute outside", filepath.Join(outside, "mydb"), "", false},
+		{"sibling prefix", dir + "x/mydb", "", false},
+		{"link to outside directory", "linkdir/mydb", "", false},
+		{"link as database file", "linkdb", "", false},
+		{"dangling link", "dangling/mydb", "", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := pathUnderDir(dir, tc.dbName)
+			if tc.ok && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatalf("expected error, got path %s", got)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
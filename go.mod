@@ -4,11 +4,9 @@ go 1.17
 
 require (
 	github.com/anssihalmeaho/funl v0.0.0-20220210165841-dde9748bcbb9
+	github.com/anssihalmeaho/fuvaluez v0.0.0-20211108180852-0b22e7f3e27a
+	github.com/anssihalmeaho/mzq v0.0.0-20220413180519-f706340db5d5
 	go.etcd.io/bbolt v1.3.6
 )
 
-require (
-	github.com/anssihalmeaho/fuvaluez v0.0.0-20211108180852-0b22e7f3e27a // indirect
-	github.com/anssihalmeaho/mzq v0.0.0-20220413180519-f706340db5d5 // indirect
-	golang.org/x/sys v0.0.0-20200923182605-d9f96fdee20d // indirect
-)
+require golang.org/x/sys v0.0.0-20200923182605-d9f96fdee20d // indirect
@@ -21,6 +21,15 @@ func main() {
 	portPtr := flag.String("port", "8080", "Port number for input")
 	codeserverAddrPtr := flag.String("csaddr", "", "address of code server, default is built-in code server")
 	packFilenamePtr := flag.String("file", "packs.db", "Filename for package storage")
+	portRangePtr := flag.String("ports", "", "Port range allocated for apps (for example 20000-20999)")
+	envAllowPtr := flag.String("env-allow", "", "Comma separated list of environment variables apps may read (* suffix matches prefix)")
+	modulesPtr := flag.String("modules", "", "Comma separated list of std modules and extensions apps may import (default is all)")
+	secretKeyPtr := flag.String("secret-key", os.Getenv("APPRUNNER_SECRET_KEY"), "Key for encrypting secrets, 32 bytes as hex digits (default from APPRUNNER_SECRET_KEY)")
+	brokerNamePtr := flag.String("broker-name", "apprunner", "Node name of default broker")
+	brokerAddrPtr := flag.String("broker-addr", "", "Address of default broker, broker is enabled if given (for example localhost:9901)")
+	brokerPeersPtr := flag.String("broker-peers", "", "Comma separated list of peer broker addresses")
+	dataDirPtr := flag.String("data-dir", "", "Base directory for app data directories")
+	restrictValuezPtr := flag.Bool("restrict-valuez", false, "Allow valuez databases only under app data directory")
 	flag.Parse()
 
 	store := codeserver.NewBoltStore(*packFilenamePtr)
@@ -34,13 +43,83 @@ func main() {
 	packGetter := func(name string) ([]byte, bool) {
 		return store.GetByName(name)
 	}
-	exeHandlerCol, exeHandlerRes := executor.GetHandler(*codeserverAddrPtr, packGetter)
+	exe := executor.NewExecutor(*codeserverAddrPtr, packGetter)
+	if *portRangePtr != "" {
+		if err := exe.SetPortRange(*portRangePtr); err != nil {
+			log.Fatalf("Invalid port range: %v", err)
+		}
+	}
+	exe.SetEnvAllowList(*envAllowPtr)
+	if *modulesPtr != "" {
+		if err := exe.SetModuleAllowList(*modulesPtr); err != nil {
+			log.Fatalf("Invalid module allow-list: %v", err)
+		}
+	}
+	if *brokerAddrPtr != "" {
+		if err := exe.SetBroker(*brokerNamePtr, *brokerAddrPtr, *brokerPeersPtr); err != nil {
+			log.Fatalf("Not able to create broker: %v", err)
+		}
+	}
+	if *dataDirPtr != "" {
+		if err := exe.SetDataDir(*dataDirPtr, *restrictValuezPtr); err != nil {
+			log.Fatalf("Not able to use data directory: %v", err)
+		}
+	} else if *restrictValuezPtr {
+		log.Fatalf("Option -restrict-valuez requires -data-dir")
+	}
+	configBucket, err := store.Bucket("configs")
+	if err != nil {
+		log.Fatalf("Not able to open storage: %v", err)
+	}
+	secretBucket, err := store.Bucket("secrets")
+	if err != nil {
+		log.Fatalf("Not able to open storage: %v", err)
+	}
+	if err := exe.SetConfigStore(configBucket, secretBucket, *secretKeyPtr); err != nil {
+		log.Fatalf("Not able to set secret key: %v", err)
+	}
+	appvalBucket, err := store.Bucket("appval")
+	if err != nil {
+		log.Fatalf("Not able to open storage: %v", err)
+	}
+	extensions.SetAppvalStorage(appvalBucket)
+	exeHandlerCol, exeHandlerRes := exe.GetHandler()
+	groupHandlerCol, groupHandlerRes := exe.GetGroupHandler()
+	scheduleHandlerCol, scheduleHandlerRes := exe.GetScheduleHandler()
+	jobHandlerCol, jobHandlerRes := exe.GetJobHandler()
+	functionHandlerCol, functionHandlerRes := exe.GetFunctionHandler()
+	configHandlerCol, configHandlerRes := exe.GetConfigHandler()
+	secretHandlerCol, secretHandlerRes := exe.GetSecretHandler()
+	appvalHandler := extensions.GetAppvalHandler()
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/packs", handlerCol)
 	mux.HandleFunc("/packs/", handlerRes)
 	mux.HandleFunc("/app", exeHandlerCol)
 	mux.HandleFunc("/app/", exeHandlerRes)
+	mux.HandleFunc("/app-groups", groupHandlerCol)
+	mux.HandleFunc("/app-groups/", groupHandlerRes)
+	mux.HandleFunc("/healthz", exe.GetHealthHandler())
+	mux.HandleFunc("/schedules", scheduleHandlerCol)
+	mux.HandleFunc("/schedules/", scheduleHandlerRes)
+	mux.HandleFunc("/jobs", jobHandlerCol)
+	mux.HandleFunc("/jobs/", jobHandlerRes)
+	mux.HandleFunc("/functions", functionHandlerCol)
+	mux.HandleFunc("/functions/", functionHandlerRes)
+	mux.HandleFunc("/fn/", exe.GetFunctionCallHandler())
+	mux.HandleFunc("/routes", exe.GetRouteHandler())
+	mux.HandleFunc("/app-exits", exe.GetExitHandler())
+	mux.HandleFunc("/configs", configHandlerCol)
+	mux.HandleFunc("/configs/", configHandlerRes)
+	mux.HandleFunc("/secrets", secretHandlerCol)
+	mux.HandleFunc("/secrets/", secretHandlerRes)
+	mux.HandleFunc("/appval", appvalHandler)
+	mux.HandleFunc("/appval/", appvalHandler)
+	mux.HandleFunc("/topics", exe.GetTopicHandler())
+	mux.HandleFunc("/app-data", exe.GetDataHandler())
+	mux.HandleFunc("/app-data/", exe.GetDataHandler())
+	mux.HandleFunc("/topics/", exe.GetTopicHandler())
+	mux.HandleFunc("/", exe.GetProxyHandler())
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%s", *portPtr),